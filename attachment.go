@@ -0,0 +1,286 @@
+package brain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// blobsDir is the folder in a brain's folder where attachments are
+	// kept, each in a file named by the SHA-256 of its contents.
+	blobsDir = "blobs"
+
+	// attachmentsKey is the metadata key that lists a cell's attachments.
+	attachmentsKey = "attachments"
+
+	// How much of a text attachment is indexed.
+	maxIndexedAttachment = 1 << 20
+)
+
+// ErrUnknownAttachment is returned when reading an attachment whose blob
+// isn't in the brain.
+var ErrUnknownAttachment = errors.New("unknown attachment")
+
+// Extensions of files whose contents are indexed as text when attached,
+// on top of any that look like text.
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".rst": true, ".org": true,
+	".csv": true, ".tsv": true, ".json": true, ".yaml": true, ".yml": true,
+	".toml": true, ".ini": true, ".xml": true, ".html": true, ".css": true,
+	".go": true, ".py": true, ".rb": true, ".js": true, ".ts": true,
+	".java": true, ".kt": true, ".c": true, ".h": true, ".cpp": true,
+	".hpp": true, ".cs": true, ".rs": true, ".swift": true, ".php": true,
+	".sh": true, ".bash": true, ".zsh": true, ".sql": true, ".lua": true,
+}
+
+// An Attachment is a file attached to a cell. Its contents are kept once
+// however many cells they are attached to, in blobs/<Hash> in the brain's
+// folder.
+type Attachment struct {
+	Name string
+
+	// Hash is the hex encoded SHA-256 of the attachment's contents.
+	Hash string
+}
+
+// Attachments returns the files attached to the cell, in the order they
+// were attached.
+//
+// They are listed in the cell's metadata under attachments, as a name and
+// hash for each separated by semicolons, so removing one from there
+// detaches it.
+func (c *Cell) Attachments() []Attachment {
+	var attachments []Attachment
+	for _, entry := range strings.Split(c.meta[attachmentsKey], ";") {
+		entry = strings.TrimSpace(entry)
+		i := strings.LastIndex(entry, " ")
+		if i < 1 || !validHash(entry[i+1:]) {
+			continue
+		}
+		attachments = append(attachments, Attachment{
+			Name: strings.TrimSpace(entry[:i]),
+			Hash: entry[i+1:],
+		})
+	}
+	return attachments
+}
+
+// Attach stores what's read from r as a file with the given name attached
+// to the cell with the given identifier. Like SetMetadata, it writes a new
+// revision of the cell. The contents of text files, such as Markdown and
+// source code, are searchable along with the cell's own.
+//
+// Attachments are kept in the brain's folder, so brains opened with
+// OpenStore can't have any, and they aren't encrypted, so neither can
+// encrypted brains.
+func (b *Brain) Attach(id, name string, r io.Reader) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	if b.dir == "" {
+		return fmt.Errorf("%w: attachments are kept in the brain's folder", ErrNotSupported)
+	}
+	if b.fs != nil && b.fs.key != nil {
+		return fmt.Errorf("%w: attachments can't be encrypted", ErrNotSupported)
+	}
+
+	name = strings.TrimSpace(strings.ReplaceAll(filepath.Base(name), ";", "_"))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return errors.New("attachments need a name")
+	}
+
+	prev, err := b.read(id)
+	if err != nil {
+		return err
+	}
+	hash, err := b.writeBlob(r)
+	if err != nil {
+		return err
+	}
+
+	meta := prev.Metadata()
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	entry := name + " " + hash
+	if list := meta[attachmentsKey]; list != "" {
+		entry = list + "; " + entry
+	}
+	meta[attachmentsKey] = entry
+	return b.revise(prev, prev.data, meta)
+}
+
+// OpenAttachment returns the contents of an attachment, which the caller
+// must close.
+func (b *Brain) OpenAttachment(a Attachment) (io.ReadCloser, error) {
+	if !validHash(a.Hash) || b.dir == "" {
+		return nil, fmt.Errorf("%w %q", ErrUnknownAttachment, a.Name)
+	}
+	f, err := os.Open(b.blobPath(a.Hash))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownAttachment, a.Name)
+	}
+	return f, err
+}
+
+// ExtractAttachment copies an attachment to the given file, which must not
+// exist yet.
+func (b *Brain) ExtractAttachment(a Attachment, fn string) error {
+	r, err := b.OpenAttachment(a)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(fn)
+		return err
+	}
+	return f.Close()
+}
+
+func (b *Brain) blobPath(hash string) string {
+	return filepath.Join(b.dir, blobsDir, hash)
+}
+
+// writeBlob stores what's read from r under its hash, unless there's
+// already a blob with the same contents, and returns the hash.
+func (b *Brain) writeBlob(r io.Reader) (string, error) {
+	dir := filepath.Join(b.dir, blobsDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(dir, ".blob-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	if _, err := os.Stat(b.blobPath(hash)); err == nil {
+		return hash, nil
+	}
+	return hash, os.Rename(tmp.Name(), b.blobPath(hash))
+}
+
+// hasBlobs reports whether anything has been attached to a cell of the
+// brain.
+func (b *Brain) hasBlobs() (bool, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(b.dir, blobsDir))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return len(entries) > 0, err
+}
+
+// removeUnusedBlobs removes the blobs no stored cell has attached, which
+// includes earlier revisions and cells in the trash, so that purging
+// cells and compacting reclaim the space taken by their attachments.
+func (b *Brain) removeUnusedBlobs() error {
+	if b.dir == "" {
+		return nil
+	}
+	dir := filepath.Join(b.dir, blobsDir)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) || (err == nil && len(entries) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	used := make(map[string]bool)
+	err = b.store.Iterate(func(c *Cell) error {
+		for _, a := range c.Attachments() {
+			used[a.Hash] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !validHash(e.Name()) || used[e.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachmentText returns the contents of the cell's attachments that are
+// text, as they are indexed.
+func (b *Brain) attachmentText(c *Cell) []string {
+	var text []string
+	for _, a := range c.Attachments() {
+		r, err := b.OpenAttachment(a)
+		if err != nil {
+			// A missing blob only means there's less to search.
+			continue
+		}
+		buf, err := ioutil.ReadAll(io.LimitReader(r, maxIndexedAttachment))
+		r.Close()
+		if err != nil || !isText(a.Name, buf) {
+			continue
+		}
+		text = append(text, string(buf))
+	}
+	return text
+}
+
+// isText reports whether an attachment with the given name and contents
+// can be indexed as text.
+func isText(name string, buf []byte) bool {
+	if !utf8.Valid(buf) {
+		// A multi-byte character may have been cut off by the limit on
+		// how much is indexed.
+		if len(buf) < maxIndexedAttachment || !utf8.Valid(buf[:len(buf)-utf8.UTFMax]) {
+			return false
+		}
+	}
+	if textExtensions[strings.ToLower(filepath.Ext(name))] {
+		return true
+	}
+	return strings.HasPrefix(http.DetectContentType(buf), "text/")
+}
+
+func validHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && s == strings.ToLower(s)
+}
@@ -0,0 +1,101 @@
+package brain
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// attach attaches a file with the given contents to a cell, and returns the
+// identifier of the revision it is attached to and the attachment.
+func attach(t *testing.T, b *Brain, id, name, contents string) (string, Attachment) {
+	t.Helper()
+
+	if err := b.Attach(id, name, strings.NewReader(contents)); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := b.newestRevision(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := b.Read(rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachments := c.Attachments()
+	return rev, attachments[len(attachments)-1]
+}
+
+func blobExists(t *testing.T, b *Brain, a Attachment) bool {
+	t.Helper()
+
+	_, err := os.Stat(b.blobPath(a.Hash))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestPurgeRemovesUnusedBlobs(t *testing.T) {
+	b, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	purged, only := attach(t, b, writeCell(t, b, "purged"), "only.txt", "only attached here")
+	shared, a := attach(t, b, writeCell(t, b, "shared"), "shared.txt", "attached to both")
+	attach(t, b, writeCell(t, b, "kept"), "shared.txt", "attached to both")
+	for _, id := range []string{purged, shared} {
+		if err := b.Delete(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Purge(shared); err != nil {
+		t.Fatal(err)
+	}
+	if !blobExists(t, b, a) {
+		t.Error("blob attached to another cell was removed")
+	}
+
+	if !blobExists(t, b, only) {
+		t.Error("blob of a cell in the trash was removed")
+	}
+	if err := b.Purge(purged); err != nil {
+		t.Fatal(err)
+	}
+	if blobExists(t, b, only) {
+		t.Error("blob only attached to a purged cell was kept")
+	}
+}
+
+func TestCompactRemovesUnusedBlobs(t *testing.T) {
+	b, err := Open(t.TempDir(), WithHistoryLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	id, a := attach(t, b, writeCell(t, b, "hello"), "hello.txt", "hello")
+	if err := b.SetMetadata(id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if !blobExists(t, b, a) {
+		t.Error("blob attached to a revision that is kept was removed")
+	}
+
+	id, err = b.newestRevision(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	editCell(t, b, id, "hello again")
+	if _, err := b.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if blobExists(t, b, a) {
+		t.Error("blob only attached to revisions compaction dropped was kept")
+	}
+}
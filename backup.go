@@ -0,0 +1,624 @@
+package brain
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// backupManifestFn is the first file in a backup, describing what the
+	// rest of it holds.
+	backupManifestFn = ".backup.json"
+	backupVersion    = 1
+
+	// The kinds of store a backup can hold.
+	backupData     = "data"
+	backupMarkdown = "markdown"
+
+	// How scheduled backups are named, which sorts them oldest first.
+	backupPrefix     = "brain-"
+	backupExt        = ".tar.gz"
+	backupTimeLayout = "2006-01-02T150405.000"
+)
+
+// ErrInvalidBackup is returned by RestoreBackup for a file that isn't a
+// backup of a brain, or holds a brain that is damaged.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// backupSkip are the files in a brain's folder that aren't backed up. The
+// index is copied separately, and the rest are only of use to the process
+// that has the brain open.
+var backupSkip = map[string]bool{
+	lockFn:           true,
+	".index.bleve":   true,
+	compactDataFn:    true,
+	compactTableFn:   true,
+	reindexTableFn:   true,
+	backupManifestFn: true,
+}
+
+// A backupManifest describes a backup.
+type backupManifest struct {
+	Version   int       `json:"version"`
+	Created   time.Time `json:"created"`
+	Store     string    `json:"store"`
+	Encrypted bool      `json:"encrypted,omitempty"`
+
+	// Index is set if the backup holds a copy of the index, otherwise it
+	// is rebuilt when the backup is restored.
+	Index bool `json:"index,omitempty"`
+}
+
+// A BackupSchedule has a brain back itself up every so often while it is
+// open, see WithBackups.
+type BackupSchedule struct {
+	// Dir is the folder backups are written to. It can be inside the
+	// brain's folder, backups leave it out.
+	Dir string
+
+	// Every is how often to back up.
+	Every time.Duration
+
+	// Keep is how many backups to keep, the oldest are removed once there
+	// are more. All of them are kept if it is 0.
+	Keep int
+}
+
+// WithBackups backs the brain up to the schedule's folder whenever it is
+// opened if the last backup is older than the schedule's interval, and
+// then every interval for as long as it stays open. A backup that fails
+// doesn't stop the brain from opening, it is tried again at the next
+// interval, and LastBackupError reports why it failed until one succeeds.
+func WithBackups(s BackupSchedule) Option {
+	return func(b *Brain) {
+		b.backups = &s
+	}
+}
+
+// Backup writes a gzipped tar archive of the brain to w, which can be
+// restored with RestoreBackup. Changes to the brain wait until the backup
+// is written, so that it is consistent, but it can still be read. The
+// index is copied as well, so that it doesn't need rebuilding when the
+// backup is restored.
+//
+// A brain opened with ReadOnly can be backed up while another process
+// has it open, but only holds what the brain held when it was opened. The
+// backup holds no index, and for a brain that keeps its cells in .data no
+// offset table either, so they are rebuilt when it is restored.
+func (b *Brain) Backup(w io.Writer) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.backup(w, nil)
+}
+
+// BackupFile writes a backup of the brain to the named file, see Backup.
+// The file only appears once the backup is complete.
+func (b *Brain) BackupFile(fn string) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.backupFile(fn)
+}
+
+func (b *Brain) backupFile(fn string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fn), "."+filepath.Base(fn)+".*")
+	if err != nil {
+		return err
+	}
+
+	// The file may be inside the brain's folder, where it mustn't back up
+	// itself.
+	err = b.backup(tmp, []string{tmp.Name(), fn})
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fn)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// backup writes a backup of the brain to w, leaving out the files and
+// folders in exclude along with the folder scheduled backups are written
+// to, should they be inside the brain's folder.
+func (b *Brain) backup(w io.Writer, exclude []string) error {
+	if b.dir == "" {
+		return fmt.Errorf("%w: the brain has no folder to back up", ErrNotSupported)
+	}
+
+	m := backupManifest{
+		Version: backupVersion,
+		Created: time.Now().UTC(),
+		Store:   backupData,
+		Index:   !b.readOnly,
+	}
+	if _, ok := b.store.(*MarkdownStore); ok {
+		m.Store = backupMarkdown
+	}
+	if b.fs != nil && b.fs.key != nil {
+		// The index of an encrypted brain is only kept in memory.
+		m.Encrypted, m.Index = true, false
+	}
+
+	index, err := ioutil.TempDir("", "brain-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(index)
+	if err := b.search.CopyTo(index); err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    backupManifestFn,
+		Mode:    0644,
+		Size:    int64(len(manifest)),
+		ModTime: m.Created,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	// The offset table and the end of .data of a brain that is open in
+	// another process may be part way through being written, so .data is
+	// only backed up as far as the snapshot we have replayed.
+	var limits map[string]int64
+	if b.backups != nil {
+		exclude = append(exclude, b.backups.Dir)
+	}
+	excluded, err := relPaths(b.dir, exclude)
+	if err != nil {
+		return err
+	}
+	skip := func(rel string) bool {
+		if excluded[filepath.Dir(rel)] && isScheduledBackup(filepath.Base(rel)) {
+			// Backups are scheduled into the brain's own folder.
+			return true
+		}
+		return backupSkip[rel] || excluded[rel] || (b.readOnly && rel == tableFn)
+	}
+	if b.readOnly && b.fs != nil {
+		limits = map[string]int64{dataFn: b.fs.snapshotSize}
+	}
+	if err := addToArchive(tw, b.dir, skip, limits); err != nil {
+		return err
+	}
+	if err := addToArchive(tw, index, nil, nil); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// relPaths returns the paths that are inside dir, relative to it.
+func relPaths(dir string, paths []string) (map[string]bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	rels := make(map[string]bool)
+	for _, p := range paths {
+		p, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rels[rel] = true
+	}
+	return rels, nil
+}
+
+// addToArchive adds every file and folder in dir to the archive, apart
+// from those skip returns true for. Only the first limits[rel] bytes of
+// the files in limits are added.
+func addToArchive(tw *tar.Writer, dir string, skip func(rel string) bool, limits map[string]int64) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if skip != nil && skip(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if n, ok := limits[rel]; ok && n < hdr.Size {
+			hdr.Size = n
+		}
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.CopyN(tw, f, hdr.Size)
+		return err
+	})
+}
+
+// RestoreBackup replaces the brain in the given folder with the one in the
+// named backup, see Backup. The backup is unpacked and checked first, and
+// the brain is only replaced if it opens and, for a brain that keeps its
+// cells in .data, passes Verify. Otherwise RestoreBackup returns an error
+// wrapping ErrInvalidBackup and the brain is left as it is.
+//
+// A backup of an encrypted brain can only be checked with its passphrase,
+// given WithPassphrase. Other options are ignored.
+//
+// Like Open, RestoreBackup fails with a *LockedError if another process
+// has the brain open.
+func RestoreBackup(fn, dir string, opts ...Option) error {
+	var o Brain
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	lock, err := acquireLock(dir)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	// Unpack next to the brain, so that it can be moved into place.
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".brain-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	m, err := unpackBackup(fn, tmp)
+	if err != nil {
+		return err
+	}
+	if err := checkBackup(tmp, m, o.passphrase); err != nil {
+		return err
+	}
+	return replaceDir(dir, tmp)
+}
+
+// unpackBackup unpacks the named backup into dir and returns its manifest.
+func unpackBackup(fn, dir string) (*backupManifest, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	tr := tar.NewReader(gz)
+
+	var m *backupManifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+
+		name := filepath.FromSlash(strings.TrimSuffix(hdr.Name, "/"))
+		if m == nil {
+			if name != backupManifestFn {
+				return nil, fmt.Errorf("%w: missing manifest", ErrInvalidBackup)
+			}
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return nil, fmt.Errorf("%w: invalid manifest: %v", ErrInvalidBackup, err)
+			}
+			if m.Version != backupVersion {
+				return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, m.Version)
+			}
+			continue
+		}
+
+		if name == "" || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) || filepath.Clean(name) != name {
+			return nil, fmt.Errorf("%w: unsafe path %q", ErrInvalidBackup, hdr.Name)
+		}
+		p := filepath.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, os.ModePerm); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+				return nil, err
+			}
+			if err := unpackFile(p, tr, hdr); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: %q isn't a file or folder", ErrInvalidBackup, hdr.Name)
+		}
+	}
+
+	if m == nil {
+		return nil, fmt.Errorf("%w: empty archive", ErrInvalidBackup)
+	}
+	return m, nil
+}
+
+func unpackFile(p string, r io.Reader, hdr *tar.Header) error {
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(p, hdr.ModTime, hdr.ModTime)
+}
+
+// checkBackup opens the brain unpacked into dir to check it is intact.
+// Nothing is purged from its trash while it's checked, that's left to the
+// options the brain is opened with once it has been restored.
+func checkBackup(dir string, m *backupManifest, passphrase string) error {
+	opts := []Option{WithTrashRetention(0)}
+	if passphrase != "" {
+		opts = append(opts, WithPassphrase(passphrase))
+	}
+
+	var b *Brain
+	var err error
+	switch m.Store {
+	case backupData:
+		b, err = Open(dir, opts...)
+	case backupMarkdown:
+		b, err = OpenMarkdown(dir, WithTrashRetention(0))
+	default:
+		return fmt.Errorf("%w: unknown store %q", ErrInvalidBackup, m.Store)
+	}
+	if errors.Is(err, ErrPassphraseRequired) || errors.Is(err, ErrWrongPassphrase) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	if m.Store == backupData {
+		if !m.Index {
+			_, err = b.Reindex()
+		}
+		var report *Report
+		if err == nil {
+			report, err = b.Verify()
+		}
+		if err == nil && !report.OK() {
+			err = fmt.Errorf("%w: the brain in it fails fsck", ErrInvalidBackup)
+		}
+	}
+	if cerr := b.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(dir, lockFn))
+}
+
+// replaceDir replaces everything in dir but its lock with what's in src,
+// putting it back if that fails part way through.
+func replaceDir(dir, src string) error {
+	old, err := ioutil.TempDir(filepath.Dir(dir), ".brain-old-")
+	if err != nil {
+		return err
+	}
+
+	moved, err := moveEntries(dir, old)
+	if err == nil {
+		_, err = moveEntries(src, dir)
+	}
+	if err != nil {
+		// Throw away whatever was moved in before putting the brain back.
+		entries, _ := ioutil.ReadDir(dir)
+		for _, e := range entries {
+			if e.Name() != lockFn {
+				os.RemoveAll(filepath.Join(dir, e.Name()))
+			}
+		}
+		for _, name := range moved {
+			os.Rename(filepath.Join(old, name), filepath.Join(dir, name))
+		}
+		os.Remove(old)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// moveEntries moves everything in one folder but a lock to another, and
+// returns the names of what it moved.
+func moveEntries(from, to string) ([]string, error) {
+	entries, err := ioutil.ReadDir(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var moved []string
+	for _, e := range entries {
+		if e.Name() == lockFn {
+			continue
+		}
+		if err := os.Rename(filepath.Join(from, e.Name()), filepath.Join(to, e.Name())); err != nil {
+			return moved, err
+		}
+		moved = append(moved, e.Name())
+	}
+	return moved, nil
+}
+
+// LastBackupError returns why the last scheduled backup failed, or nil if
+// it succeeded or the brain isn't backed up on a schedule, see WithBackups.
+func (b *Brain) LastBackupError() error {
+	b.backupMu.Lock()
+	defer b.backupMu.Unlock()
+	return b.backupErr
+}
+
+// startBackups backs the brain up if a scheduled backup is due, and keeps
+// backing it up on schedule until it is closed. Backups that fail are
+// recorded for LastBackupError rather than returned.
+func (b *Brain) startBackups() {
+	s := b.backups
+	if s == nil || s.Every <= 0 {
+		return
+	}
+	b.recordBackup(b.scheduledBackup(true))
+
+	b.stopBackups = make(chan struct{})
+	b.backingUp.Add(1)
+	go func() {
+		defer b.backingUp.Done()
+
+		ticker := time.NewTicker(s.Every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.recordBackup(b.scheduledBackup(false))
+			case <-b.stopBackups:
+				return
+			}
+		}
+	}()
+}
+
+func (b *Brain) recordBackup(err error) {
+	if err != nil {
+		err = fmt.Errorf("backing up to %s: %w", b.backups.Dir, err)
+	}
+	b.backupMu.Lock()
+	b.backupErr = err
+	b.backupMu.Unlock()
+}
+
+// scheduledBackup writes a backup to the schedule's folder, only if the
+// last one is older than its interval when ifDue is set, and removes the
+// oldest that are no longer kept.
+func (b *Brain) scheduledBackup(ifDue bool) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	s := b.backups
+	if err := os.MkdirAll(s.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	backups, err := scheduledBackups(s.Dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if n := len(backups); ifDue && n > 0 {
+		info, err := os.Stat(filepath.Join(s.Dir, backups[n-1]))
+		if err != nil {
+			return err
+		}
+		if now.Sub(info.ModTime()) < s.Every {
+			return nil
+		}
+	}
+
+	name := backupPrefix + now.UTC().Format(backupTimeLayout) + backupExt
+	if err := b.backupFile(filepath.Join(s.Dir, name)); err != nil {
+		return err
+	}
+	backups = append(backups, name)
+
+	if s.Keep <= 0 || len(backups) <= s.Keep {
+		return nil
+	}
+	for _, name := range backups[:len(backups)-s.Keep] {
+		if err := os.Remove(filepath.Join(s.Dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scheduledBackups returns the names of the scheduled backups in dir,
+// oldest first.
+func scheduledBackups(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if isScheduledBackup(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// isScheduledBackup reports whether a file is named like a scheduled
+// backup.
+func isScheduledBackup(name string) bool {
+	return strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupExt)
+}
@@ -0,0 +1,197 @@
+package brain
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backupNames returns the names of the files and folders in a backup.
+func backupNames(t *testing.T, fn string) []string {
+	t.Helper()
+
+	f, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+func TestRestoreBackupKeepsOldTrash(t *testing.T) {
+	b, err := Open(t.TempDir(), WithTrashRetention(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := writeCell(t, b, "trashed long ago")
+	if err := b.store.SetTrashed(id, time.Now().AddDate(-1, 0, 0).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.search.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if err := b.BackupFile(fn); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	dir := t.TempDir()
+	if err := RestoreBackup(fn, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = Open(dir, WithTrashRetention(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	c, err := b.Read(id)
+	if err != nil {
+		t.Fatalf("trashed cell was purged by restoring: %v", err)
+	}
+	if c.TrashedAt().IsZero() {
+		t.Error("trashed cell was taken out of the trash by restoring")
+	}
+}
+
+func TestBackupLeavesOutBackupsInsideBrain(t *testing.T) {
+	for _, sub := range []string{"backups", ""} {
+		dir := t.TempDir()
+		s := BackupSchedule{Dir: filepath.Join(dir, sub), Every: time.Hour}
+		b, err := Open(dir, WithBackups(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeCell(t, b, "hello")
+
+		for i := 0; i < 2; i++ {
+			if err := b.BackupFile(filepath.Join(dir, "manual.tar.gz")); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.scheduledBackup(false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		b.Close()
+
+		backups, err := scheduledBackups(s.Dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(backups) != 3 {
+			t.Fatalf("%d scheduled backups, want 3", len(backups))
+		}
+		for _, name := range backupNames(t, filepath.Join(dir, "manual.tar.gz")) {
+			if strings.Contains(name, "manual") {
+				t.Errorf("backup holds itself as %s", name)
+			}
+		}
+		for _, name := range backupNames(t, filepath.Join(s.Dir, backups[2])) {
+			if strings.Contains(name, backupPrefix) || (sub != "" && strings.HasPrefix(name, sub)) {
+				t.Errorf("scheduled backup holds %s", name)
+			}
+		}
+	}
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	b, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := writeCell(t, b, "first")
+	edited := editCell(t, b, first, "edited")
+
+	fn := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if err := b.BackupFile(fn); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	// Restoring replaces whatever brain was there.
+	dir := t.TempDir()
+	b, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced := writeCell(t, b, "replaced")
+	b.Close()
+
+	if err := RestoreBackup(fn, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	ids, err := b.indexedIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || !ids[edited] {
+		t.Errorf("restored brain indexes %v, want only %s", ids, edited)
+	}
+	if _, err := b.Read(replaced); err == nil {
+		t.Error("restored brain still holds the cell it replaced")
+	}
+	history, err := b.History(edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[1].Data() != "first" {
+		t.Errorf("restored history has %d revisions, want the edit and %q", len(history), "first")
+	}
+}
+
+func TestRestoreInvalidBackup(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := writeCell(t, b, "kept")
+	b.Close()
+
+	fn := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if err := os.WriteFile(fn, []byte("not a backup"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreBackup(fn, dir); !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("restoring %q = %v, want ErrInvalidBackup", "not a backup", err)
+	}
+
+	b, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if c, err := b.Read(id); err != nil || c.Data() != "kept" {
+		t.Errorf("brain changed by a failed restore: %v, %v", c, err)
+	}
+}
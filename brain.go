@@ -1,7 +1,11 @@
 package brain
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/sno6/brain/search"
 )
@@ -14,114 +18,514 @@ const (
 // Brain is the main driver for reading, writing, and querying
 // your brain data file.
 //
-// Brain writes to the ~/.brain folder on your hard-drive, creating
-// the following files:
+// By default Brain writes to the ~/.brain folder on your hard-drive,
+// see Open to use another folder, or OpenStore to keep cells somewhere
+// else entirely. It creates the following files:
 //
 // - .data which stores raw cell data.
+// - .offsets which maps cell identifiers to their location in .data.
 // - .index.bleve/ which stores all index data used for querying.
+// - .lock which is held by the process that has the brain open.
+// - .key which holds what's needed to check the passphrase of an
+//   encrypted brain, see Encrypt.
+//
+// Only one process may open a brain at a time, but others can still read
+// it with ReadOnly. A Brain is safe for concurrent use by goroutines.
 //
 type Brain struct {
-	data   *os.File
+	dir    string
+	store  Store
 	search *search.Search
+	lock   *dirLock
+
+	// fs is the store of a brain that keeps its cells in .data, which is
+	// what compaction, fsck and encryption work on. It is nil for brains
+	// opened with OpenStore.
+	fs *fileStore
+
+	// The passphrase and compression options for the brain's files. The
+	// passphrase is only kept until the brain is opened.
+	passphrase string
+	compress   bool
+
+	// git is set by WithGit.
+	git bool
+
+	// The schedule set by WithBackups, and what stops the goroutine that
+	// keeps to it when the brain is closed.
+	backups     *BackupSchedule
+	stopBackups chan struct{}
+	backingUp   sync.WaitGroup
+
+	// mu guards every field above. Changes hold it for writing for their
+	// whole duration, so that a record's offset can't be taken by another
+	// goroutine between allocating it and appending the record.
+	mu sync.RWMutex
+
+	// readOnly is set when the brain was opened with ReadOnly.
+	readOnly bool
+
+	// How long cells stay in the trash before they are purged.
+	retention time.Duration
+
+	// How many earlier revisions of each cell compaction keeps.
+	historyLimit int
+
+	// Why the last scheduled backup failed, or nil if it didn't. It has a
+	// lock of its own since backups only hold mu for reading.
+	backupErr error
+	backupMu  sync.Mutex
+
+	// The revision that replaced each cell that has been edited, see
+	// newestRevision. It has a lock of its own since links are resolved
+	// while only holding mu for reading.
+	successors   map[string]string
+	successorsMu sync.Mutex
+}
+
+// An Option configures a Brain as it is opened.
+type Option func(*Brain)
+
+// WithTrashRetention sets how long deleted cells stay in the trash before
+// they are purged, see SetTrashRetention.
+func WithTrashRetention(d time.Duration) Option {
+	return func(b *Brain) {
+		b.retention = d
+	}
+}
+
+// WithHistoryLimit sets how many earlier revisions of each cell are kept
+// when .data is compacted, the most recent first. A limit of 0 keeps every
+// revision, so that compaction only reclaims purged cells.
+func WithHistoryLimit(n int) Option {
+	return func(b *Brain) {
+		b.historyLimit = n
+	}
+}
+
+// ReadOnly opens a brain without taking the lock held by the process that
+// writes to it, so that it can be read while that process is running.
+//
+// Rather than share the writer's index, the cells are replayed from .data
+// as it was when the brain was opened and indexed in memory, so changes
+// made afterwards aren't seen. Any attempt to change the brain fails with
+// ErrReadOnly.
+func ReadOnly() Option {
+	return func(b *Brain) {
+		b.readOnly = true
+	}
 }
 
-// New initialises a new Brain.
+// New initialises a new Brain in the ~/.brain folder.
 func New() (*Brain, error) {
-	data, dir, err := initBrain()
+	dir, err := DefaultDir()
 	if err != nil {
 		return nil, err
 	}
-	s, err := search.New(dir)
+	return Open(dir)
+}
+
+// Open initialises a Brain in the given folder, creating it if it
+// doesn't exist yet.
+//
+// If another process already has the brain open, Open returns a
+// *LockedError unless the ReadOnly option is given.
+func Open(dir string, opts ...Option) (*Brain, error) {
+	b := &Brain{
+		dir:          dir,
+		retention:    DefaultTrashRetention,
+		historyLimit: DefaultHistoryLimit,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if b.git {
+		return nil, fmt.Errorf("%w: only Markdown brains can be kept in git", ErrNotSupported)
+	}
+	if b.readOnly {
+		if err := b.openSnapshot(); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	lock, err := acquireLock(dir)
 	if err != nil {
 		return nil, err
 	}
-	return &Brain{
-		data:   data,
-		search: s,
-	}, nil
+	if err := b.open(); err != nil {
+		lock.release()
+		return nil, err
+	}
+	b.lock = lock
+	b.startBackups()
+	return b, nil
+}
+
+// open opens the files of a brain we hold the lock for, finishing any
+// interrupted compaction or migration.
+func (b *Brain) open() error {
+	fs, err := openFileStore(b.dir, b.passphrase, b.compress)
+	if err != nil {
+		return err
+	}
+	b.passphrase = ""
+	b.store, b.fs = fs, fs
+	hadIndex := search.Exists(b.dir)
+	if b.search, err = search.New(b.dir); err != nil {
+		return err
+	}
+
+	if err := b.recoverCompaction(); err != nil {
+		return err
+	}
+	if err := b.migrate(hadIndex); err != nil {
+		return err
+	}
+	if fs.key != nil {
+		// The index of an encrypted brain is only kept in memory. We open
+		// the one on disk all the same, in case it holds a compaction that
+		// was interrupted while encrypting the brain.
+		if err := b.useMemIndex(); err != nil {
+			return err
+		}
+	} else if err := b.upgradeIndex(); err != nil {
+		return err
+	}
+	_, err = b.purgeExpired()
+	return err
+}
+
+// Close stops any scheduled backups, closes the store and the index, and
+// releases the lock.
+func (b *Brain) Close() error {
+	if b.stopBackups != nil {
+		close(b.stopBackups)
+		b.backingUp.Wait()
+		b.stopBackups = nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.store.Close(); err != nil {
+		return err
+	}
+	if err := b.search.Close(); err != nil {
+		return err
+	}
+	if b.lock != nil {
+		return b.lock.release()
+	}
+	return nil
+}
+
+// ReadOnly reports whether the brain was opened with ReadOnly.
+func (b *Brain) ReadOnly() bool {
+	return b.readOnly
 }
 
 // Write spawns an editor to capture user input, and pipes the bytes to
 // the .data file. It then indexes the content for future queries.
 func (b *Brain) Write(s string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
 	if s == "" {
 		return nil
 	}
 
-	cell, err := b.buildCellFromData(s)
+	cell := NewCell(0, s)
+	if err := b.store.Append(cell); err != nil {
+		return err
+	}
+	return b.search.Index(cell.Identifier(), b.document(cell))
+}
+
+// Read reads a cell in .data by a given identifier.
+//
+// The identifier is either a cell's stable identifier or, for cells written
+// before stable identifiers existed, its legacy offset:size identifier.
+func (b *Brain) Read(id string) (*Cell, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.read(id)
+}
+
+func (b *Brain) read(id string) (*Cell, error) {
+	return b.store.Read(id)
+}
+
+// MarkViewed records that the cell with the given identifier was viewed
+// just now, for searches that list the cells viewed most recently first,
+// see search.RecentlyViewed. Revisions of the cell carry it over.
+//
+// When cells were viewed is kept in the index, so it's forgotten along
+// with the index of an encrypted brain when the brain is closed.
+func (b *Brain) MarkViewed(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	cell, err := b.read(id)
 	if err != nil {
 		return err
 	}
-	if err := b.writeCell(cell); err != nil {
+	if cell.trashed != 0 {
+		return nil
+	}
+
+	batch := b.search.NewBatch()
+	batch.SetViewed(cell.id, time.Now())
+	if err := batch.Index(cell.id, b.document(cell)); err != nil {
 		return err
 	}
-	return b.search.Index(cell.Identifier(), s)
+	return batch.Commit()
 }
 
-// Read reads a cell in .data by a given identifier.
-func (b *Brain) Read(id string) (*Cell, error) {
-	offset, sz, err := parseIdentifier(id)
+// A Hit is a cell that matched a search.
+type Hit struct {
+	Cell *Cell
+
+	// Score is how well the cell matched, the higher the better.
+	Score float64
+
+	// Fragments are the parts of the cell, then of its attachments, where
+	// the search matched, with the terms that matched marked.
+	Fragments []search.Fragment
+}
+
+// A Page is a page of the cells that match a search, see List.
+type Page struct {
+	Hits []Hit
+
+	// Offset is how many matches come before the page, and Total how many
+	// there are across every page.
+	Offset int
+	Total  int
+}
+
+// More reports whether there are matches after the page.
+func (p *Page) More() bool {
+	return p.Offset+len(p.Hits) < p.Total
+}
+
+// List searches for cells within .data by checking the index against
+// a given query and returns the page of cells that match which the
+// request asks for, best first unless it asks for another order.
+func (b *Brain) List(r search.Request) (*Page, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	res, err := b.search.Query(r)
 	if err != nil {
 		return nil, err
 	}
-	return b.readCell(offset, sz)
+
+	hits := make([]Hit, len(res.Hits))
+	for i, h := range res.Hits {
+		cell, err := b.read(h.ID)
+		if err != nil {
+			return nil, err
+		}
+		hits[i] = Hit{Cell: cell, Score: h.Score, Fragments: h.Fragments}
+	}
+	return &Page{Hits: hits, Offset: r.Offset, Total: int(res.Total)}, nil
 }
 
-// List searches for cells within .data by checking the index against
-// a given query and returns any cells that match.
-func (b *Brain) List(query string, mode search.Mode) ([]*Cell, error) {
-	ids, err := b.search.Query(query, mode)
+// Edit replaces the contents of the cell with the given identifier by
+// writing a new cell that supersedes it. The original is kept as an
+// earlier revision of the new cell, see History. Editing a cell down to
+// nothing deletes it. The cell's metadata is carried over.
+func (b *Brain) Edit(id, s string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	return b.edit(id, s)
+}
+
+func (b *Brain) edit(id, s string) error {
+	if s == "" {
+		return b.delete(id)
+	}
+
+	prev, err := b.read(id)
+	if err != nil {
+		return err
+	}
+	return b.revise(prev, s, prev.meta)
+}
+
+// revise writes a new revision of a cell with the given data and metadata.
+func (b *Brain) revise(prev *Cell, s string, meta map[string]string) error {
+	cell := NewCell(0, s)
+	cell.supersedes = prev.id
+	cell.meta = meta
+
+	if err := b.store.Append(cell); err != nil {
+		return err
+	}
+	b.addSuccessor(prev.id, cell.id)
+
+	batch := b.search.NewBatch()
+	if t := b.search.LastViewed(cell.supersedes); !t.IsZero() {
+		batch.SetViewed(cell.id, t)
+	}
+	batch.Delete(cell.supersedes)
+	if err := batch.Index(cell.Identifier(), b.document(cell)); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
+
+// History returns the cell with the given identifier followed by each of
+// its earlier revisions, newest first.
+func (b *Brain) History(id string) ([]*Cell, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.history(id)
+}
+
+func (b *Brain) history(id string) ([]*Cell, error) {
+	cell, err := b.read(id)
 	if err != nil {
 		return nil, err
 	}
-	return b.readCells(ids)
+
+	cells := []*Cell{cell}
+	for cell.supersedes != "" {
+		cell, err = b.read(cell.supersedes)
+		if errors.Is(err, ErrUnknownCell) {
+			// Revisions edited before history was kept are gone.
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell)
+	}
+
+	return cells, nil
 }
 
-// Delete removes a document from the index by its ID.
+// Delete moves a cell to the trash by its ID, see Trash.
 //
-// The underlying data will remain in the data file, we are only
-// removing the pointer to the data. We do this because document ids
-// are offset references and deleting previous records would require
-// a re-index of all records > n.
+// A tombstone is appended to the data file so that it remains the source
+// of truth for which cells are live, but the cell's data remains there
+// until it is purged from the trash and the data file is compacted.
 func (b *Brain) Delete(id string) error {
-	return b.search.Delete(id)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	return b.delete(id)
 }
 
-func (b *Brain) buildCellFromData(data string) (*Cell, error) {
-	offset, err := size(b.data)
+func (b *Brain) delete(id string) error {
+	cell, err := b.read(id)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if cell.trashed != 0 {
+		return nil
 	}
-	return NewCell(offset, data), nil
-}
 
-func (b *Brain) writeCell(cell *Cell) error {
-	_, err := b.data.Write(cell.Marshal())
-	return err
+	if err := b.store.SetTrashed(cell.id, time.Now().UTC().Unix()); err != nil {
+		return err
+	}
+	// When the cell was last viewed is kept in case it is restored.
+	return b.search.Unindex(cell.id)
 }
 
-func (b *Brain) readCell(offset, size int64) (*Cell, error) {
-	buf := make([]byte, size)
-	_, err := b.data.ReadAt(buf, offset)
+// migrate converts a .data file written in an older format to the
+// current one. The migration is a compaction, so it carries over every
+// live cell and is safe to interrupt. hadIndex is whether the index was
+// there before the brain was opened.
+func (b *Brain) migrate(hadIndex bool) error {
+	version, err := readVersion(b.fs.data)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if version == formatVersion {
+		return nil
+	}
+
+	sz, err := size(b.fs.data)
+	if err != nil {
+		return err
+	}
+	if sz == 0 {
+		return writeHeader(b.fs.data)
+	}
+
+	// Older formats can't tell deleted cells from live ones on their own,
+	// so the index is the only record of which cells to carry over. An
+	// empty index that was already there means every cell was deleted, in
+	// which case the data file is rewritten without any, but one that was
+	// only just created means the index is missing.
+	ids, err := b.search.IDs()
+	if err != nil {
+		return err
+	}
+	for id := range b.fs.table.trash {
+		ids = append(ids, id)
 	}
-	return ParseCell(offset, string(buf))
+	if len(ids) == 0 && !hadIndex {
+		return errors.New("can't migrate data file without its index")
+	}
+
+	b.fs.legacy = version == 0
+	cells, err := b.readCells(ids)
+	if err == nil {
+		_, err = b.rewriteData(cells, nil, b.fs.codec())
+	}
+	if err != nil {
+		return fmt.Errorf("migrating data file: %w", err)
+	}
+	b.fs.legacy = false
+	return nil
 }
 
-func (b *Brain) readCells(ids []string) ([]*Cell, error) {
-	if len(ids) == 0 {
-		return nil, nil
+// document returns what is indexed for a cell.
+func (b *Brain) document(c *Cell) search.Document {
+	return search.Document{
+		Content:     c.data,
+		Created:     time.Unix(b.createdAt(c), 0),
+		Updated:     c.Timestamp(),
+		Tags:        c.Tags(),
+		Meta:        c.meta,
+		Links:       c.linkKeys(),
+		Names:       c.names(),
+		Attachments: b.attachmentText(c),
 	}
+}
 
-	cells := make([]*Cell, len(ids))
-	for i, id := range ids {
-		cell, err := b.Read(id)
+// createdAt returns when the first revision of the cell that is still
+// kept was written.
+func (b *Brain) createdAt(c *Cell) int64 {
+	for c.created == 0 && c.supersedes != "" {
+		prev, err := b.read(c.supersedes)
 		if err != nil {
-			return nil, err
+			break
 		}
-		cells[i] = cell
+		c = prev
 	}
-
-	return cells, nil
+	if c.created != 0 {
+		return c.created
+	}
+	return c.ts
 }
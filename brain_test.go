@@ -0,0 +1,162 @@
+package brain
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/sno6/brain/search"
+)
+
+// writeLegacyBrain writes a brain in the format used before .data was
+// framed, holding the given records, with an index of the cells with the
+// given legacy identifiers.
+func writeLegacyBrain(t *testing.T, records string, indexed map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, dataFn), []byte(records), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := search.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, content := range indexed {
+		err := s.Index(id, search.Document{Content: content, Created: time.Unix(1600000000, 0), Updated: time.Unix(1600000000, 0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestOpenMigratesLegacyBrain(t *testing.T) {
+	// The second cell was deleted, which only took it out of the index.
+	dir := writeLegacyBrain(t, "1600000000 hello1600000001 gone", map[string]string{"0:16": "hello"})
+
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if v, err := readVersion(b.fs.data); err != nil || v != formatVersion {
+		t.Fatalf("version = %d, %v, want %d", v, err, formatVersion)
+	}
+
+	c, err := b.Read("0:16")
+	if err != nil {
+		t.Fatalf("reading by legacy identifier: %v", err)
+	}
+	if c.Data() != "hello" || c.Timestamp().Unix() != 1600000000 {
+		t.Errorf("cell = %q at %d, want %q at 1600000000", c.Data(), c.Timestamp().Unix(), "hello")
+	}
+	if c.Identifier() == "0:16" {
+		t.Error("migrated cell wasn't given a stable identifier")
+	}
+	if _, err := b.Read(c.Identifier()); err != nil {
+		t.Errorf("reading by stable identifier: %v", err)
+	}
+
+	ids, err := b.search.IDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != c.Identifier() {
+		t.Errorf("indexed %v, want [%s]", ids, c.Identifier())
+	}
+
+	stats, err := b.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Cells != 1 || stats.Records != 1 {
+		t.Errorf("%d cells in %d records, want the deleted cell dropped", stats.Cells, stats.Records)
+	}
+}
+
+func TestOpenMigratesLegacyBrainWithEveryCellDeleted(t *testing.T) {
+	dir := writeLegacyBrain(t, "1600000000 gone", nil)
+
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if sz, err := size(b.fs.data); err != nil || sz != headerSize {
+		t.Errorf(".data is %d bytes, %v, want just its header", sz, err)
+	}
+}
+
+func TestOpenRefusesToMigrateWithoutIndex(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, dataFn), []byte("1600000000 hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Open(dir)
+	if err == nil {
+		b.Close()
+		t.Fatal("Open() succeeded without the index of a legacy brain")
+	}
+
+	data, err := os.ReadFile(path.Join(dir, dataFn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1600000000 hello" {
+		t.Errorf(".data = %q, want it left alone", data)
+	}
+}
+
+func TestListPages(t *testing.T) {
+	b, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	for i := 0; i < 5; i++ {
+		writeCell(t, b, "cell")
+	}
+
+	tests := []struct {
+		offset, size int
+		hits         int
+		more         bool
+	}{
+		{0, 2, 2, true},
+		{2, 2, 2, true},
+		{4, 2, 1, false},
+		{3, 2, 2, false},
+		{5, 2, 0, false},
+		{0, 5, 5, false},
+		{0, 0, 5, false},
+	}
+	for _, tt := range tests {
+		page, err := b.List(search.Request{Query: "cell", Offset: tt.offset, Size: tt.size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 5 || page.Offset != tt.offset {
+			t.Errorf("page at %d of %d: total %d at offset %d, want 5 at %d", tt.offset, tt.size, page.Total, page.Offset, tt.offset)
+		}
+		if len(page.Hits) != tt.hits || page.More() != tt.more {
+			t.Errorf("page at %d of %d: %d hits, more %v, want %d, more %v", tt.offset, tt.size, len(page.Hits), page.More(), tt.hits, tt.more)
+		}
+	}
+
+	page, err := b.List(search.Request{Query: "nothing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 0 || page.More() {
+		t.Errorf("empty page: total %d, more %v, want 0 and no more", page.Total, page.More())
+	}
+}
@@ -1,78 +1,296 @@
 package brain
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
+
+	"github.com/oklog/ulid/v2"
 )
 
 // A Cell is any individual idea / thought / note that is written
-// to Brain. On disk, a cell is a byte array prepended with a UTC
-// timestamp that starts at some byte offset in the .data file.
+// to Brain. On disk, a cell is a framed record holding its stable
+// identifier, a UTC timestamp and its data, that starts at some byte
+// offset in the .data file.
 type Cell struct {
+	id     string
 	offset int64
 	ts     int64
 	data   string
+
+	// When the first revision of the cell was written, if its store keeps
+	// track of it. Otherwise it's found by going through the revisions.
+	created int64
+
+	// The identifier of the cell this cell replaced when it was edited.
+	supersedes string
+
+	// The offset:size identifier the cell had before it was migrated.
+	legacyID string
+
+	// When the cell was moved to the trash, or 0 if it's not in the trash.
+	trashed int64
+
+	// Metadata about the cell, such as its title, source or author.
+	meta map[string]string
+
+	// Tags the cell was given by its store on top of those in its data.
+	tags []string
+}
+
+// Kinds of record in .data.
+const (
+	kindCell = ""
+
+	// A tombstone moves a cell to the trash.
+	kindTombstone = "tombstone"
+
+	// A restore takes a cell back out of the trash.
+	kindRestore = "restore"
+
+	// A purge deletes a cell from the trash for good.
+	kindPurge = "purge"
+)
+
+// cellRecord is the payload of a record in .data. Most records hold a
+// cell, but deleting, restoring and purging cells append records too so
+// that .data alone is enough to know the state of every cell.
+type cellRecord struct {
+	Kind       string            `json:"kind,omitempty"`
+	ID         string            `json:"id"`
+	TS         int64             `json:"ts"`
+	Data       string            `json:"data,omitempty"`
+	Supersedes string            `json:"supersedes,omitempty"`
+	Legacy     string            `json:"legacy,omitempty"`
+	Meta       map[string]string `json:"meta,omitempty"`
+
+	// Created is when the cell was first written, which is only recorded
+	// once the revision that says so has been dropped, see Compact.
+	Created int64 `json:"created,omitempty"`
 }
 
-// NewCell returns a new cell with the given data.
+// NewCell returns a new cell with the given data and a fresh identifier.
 func NewCell(offset int64, data string) *Cell {
 	return &Cell{
+		id:     newID(),
 		offset: offset,
 		ts:     time.Now().UTC().Unix(),
 		data:   data,
 	}
 }
 
-func ParseCell(offset int64, data string) (*Cell, error) {
-	if len(data) < 11 {
-		return nil, errors.New("data does not include timestamp")
+// ParseCell parses the record read from the given offset, returning
+// ErrCorruptRecord if it fails validation.
+//
+// Records in an encrypted brain can only be parsed by the Brain itself,
+// ParseCell returns ErrPassphraseRequired for them.
+func ParseCell(offset int64, data []byte) (*Cell, error) {
+	return parseCell(offset, data, codec{})
+}
+
+// parseCell parses a record, decoding it with enc.
+func parseCell(offset int64, data []byte, enc codec) (*Cell, error) {
+	r, err := parseRecord(data, enc)
+	if err != nil {
+		return nil, err
 	}
-	return &Cell{
-		offset: offset,
-		data:   data[11:],
-		ts:     parseTimestamp(data),
-	}, nil
+	if r.Kind != kindCell {
+		return nil, fmt.Errorf("record at offset %d is a %s, not a cell", offset, r.Kind)
+	}
+	return r.cell(offset), nil
 }
 
 func (c *Cell) Identifier() string {
-	return fmt.Sprintf("%d:%d", c.offset, len(c.Marshal()))
+	return c.id
 }
 
+// Marshal returns the cell's framed record, neither compressed nor
+// sealed.
 func (c *Cell) Marshal() []byte {
-	return []byte(
-		fmt.Sprintf("%d %s", c.ts, c.data),
-	)
+	buf, _ := c.marshal(codec{})
+	return buf
+}
+
+// marshal returns the cell's framed record, encoded with enc.
+func (c *Cell) marshal(enc codec) ([]byte, error) {
+	return marshalRecord(cellRecord{
+		ID:         c.id,
+		TS:         c.ts,
+		Data:       c.data,
+		Supersedes: c.supersedes,
+		Legacy:     c.legacyID,
+		Meta:       c.meta,
+		Created:    c.created,
+	}, enc)
+}
+
+// Previous returns the identifier of the revision this cell replaced when
+// it was edited, or an empty string if it is the first revision.
+func (c *Cell) Previous() string {
+	return c.supersedes
+}
+
+// TrashedAt returns when the cell was moved to the trash, or the zero
+// time if it isn't in the trash.
+func (c *Cell) TrashedAt() time.Time {
+	if c.trashed == 0 {
+		return time.Time{}
+	}
+	return time.Unix(c.trashed, 0)
 }
 
 func (c *Cell) Data() string {
 	return c.data
 }
 
+// Metadata returns a copy of the cell's metadata, which is nil if it has
+// none.
+func (c *Cell) Metadata() map[string]string {
+	if len(c.meta) == 0 {
+		return nil
+	}
+	meta := make(map[string]string, len(c.meta))
+	for k, v := range c.meta {
+		meta[k] = v
+	}
+	return meta
+}
+
 func (c *Cell) Timestamp() time.Time {
 	return time.Unix(c.ts, 0)
 }
 
-func parseTimestamp(data string) int64 {
-	n, _ := strconv.ParseInt(data[:10], 10, 64)
-	return n
+// A CellState is everything a Store keeps about a cell. Stores get it from
+// the cells they are given with Cell.State, and make the cells they return
+// from it with RestoreCell.
+type CellState struct {
+	ID string
+
+	// Time is when the revision was written, to the second.
+	Time time.Time
+	Data string
+
+	// Previous is the identifier of the revision this one replaced, see
+	// Cell.Previous.
+	Previous string
+	Metadata map[string]string
+
+	// Created is when the first revision of the cell was written, or the
+	// zero time if the store doesn't keep track of it, in which case it's
+	// found by going through the revisions.
+	Created time.Time
+
+	// Trashed is when the cell was moved to the trash, or the zero time if
+	// it isn't in the trash.
+	Trashed time.Time
+
+	// Tags are tags the store gives the cell on top of those in its data.
+	Tags []string
+}
+
+// State returns what a Store keeps about the cell.
+func (c *Cell) State() CellState {
+	return CellState{
+		ID:       c.id,
+		Time:     unixTime(c.ts),
+		Data:     c.data,
+		Previous: c.supersedes,
+		Metadata: c.Metadata(),
+		Created:  unixTime(c.created),
+		Trashed:  unixTime(c.trashed),
+		Tags:     append([]string(nil), c.tags...),
+	}
 }
 
-func parseIdentifier(id string) (int64, int64, error) {
-	ids := strings.Split(id, ":")
-	if len(ids) != 2 {
-		return 0, 0, errors.New("invalid cell identifier")
+// RestoreCell returns the cell a Store kept the state of.
+func RestoreCell(s CellState) *Cell {
+	c := &Cell{
+		id:         s.ID,
+		ts:         unixSeconds(s.Time),
+		data:       s.Data,
+		supersedes: s.Previous,
+		created:    unixSeconds(s.Created),
+		trashed:    unixSeconds(s.Trashed),
+		tags:       append([]string(nil), s.Tags...),
 	}
+	if len(s.Metadata) > 0 {
+		c.meta = make(map[string]string, len(s.Metadata))
+		for k, v := range s.Metadata {
+			c.meta[k] = v
+		}
+	}
+	return c
+}
+
+// unixTime returns the time of a unix timestamp, or the zero time for 0.
+func unixTime(ts int64) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts, 0).UTC()
+}
+
+// unixSeconds returns the unix timestamp of a time, or 0 for the zero
+// time.
+func unixSeconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
 
-	offset, err := strconv.ParseInt(ids[0], 10, 64)
+// marker returns the framed record of the given kind that changes the
+// state of the cell with the given identifier at ts, encoded with enc.
+func marker(kind, id string, ts int64, enc codec) ([]byte, error) {
+	return marshalRecord(cellRecord{
+		Kind: kind,
+		ID:   id,
+		TS:   ts,
+	}, enc)
+}
+
+func marshalRecord(r cellRecord, enc codec) ([]byte, error) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	flags, payload, err := enc.encode(payload)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
-	size, err := strconv.ParseInt(ids[1], 10, 64)
+	return frame(flags, payload), nil
+}
+
+func parseRecord(data []byte, enc codec) (*cellRecord, error) {
+	flags, payload, err := unframe(data)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
-	return offset, size, nil
+	if payload, err = enc.decode(flags, payload); err != nil {
+		return nil, err
+	}
+
+	var r cellRecord
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptRecord, err)
+	}
+	return &r, nil
+}
+
+func (r *cellRecord) cell(offset int64) *Cell {
+	return &Cell{
+		id:         r.ID,
+		offset:     offset,
+		ts:         r.TS,
+		data:       r.Data,
+		supersedes: r.Supersedes,
+		legacyID:   r.Legacy,
+		meta:       r.Meta,
+		created:    r.Created,
+	}
+}
+
+// newID returns a new opaque, time-ordered cell identifier.
+func newID() string {
+	return ulid.Make().String()
 }
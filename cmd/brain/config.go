@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sno6/brain"
+)
+
+// A profile is a named brain defined in the config file.
+type profile struct {
+	Dir            string `json:"dir"`
+	TrashRetention string `json:"trash_retention,omitempty"`
+	HistoryLimit   *int   `json:"history_limit,omitempty"`
+	Compress       bool   `json:"compress,omitempty"`
+	Store          string `json:"store,omitempty"`
+	Git            bool   `json:"git,omitempty"`
+
+	Backup *backupConfig `json:"backup,omitempty"`
+}
+
+// A backupConfig schedules rolling backups of a brain.
+type backupConfig struct {
+	Dir   string `json:"dir"`
+	Every string `json:"every"`
+	Keep  int    `json:"keep,omitempty"`
+}
+
+// Kinds of store a brain can keep its cells in.
+const (
+	storeData     = "data"
+	storeMarkdown = "markdown"
+)
+
+// A target is the brain to open, and how to open it.
+type target struct {
+	dir      string
+	markdown bool
+	opts     []brain.Option
+}
+
+// A config holds the named brains a user has set up. It is read from
+// brain/config.json in the user's config directory, or $BRAIN_CONFIG if
+// it is set, and looks like:
+//
+//	{
+//		"default": "personal",
+//		"profiles": {
+//			"personal": {"dir": "~/.brain"},
+//			"work": {
+//				"dir": "/Volumes/Vault/brain",
+//				"trash_retention": "720h",
+//				"history_limit": 20,
+//				"compress": true,
+//				"backup": {"dir": "/Volumes/Backup/brain", "every": "24h", "keep": 7}
+//			},
+//			"notes": {"dir": "~/Obsidian/Notes", "store": "markdown", "git": true}
+//		}
+//	}
+type config struct {
+	Default  string             `json:"default"`
+	Profiles map[string]profile `json:"profiles"`
+}
+
+// loadConfig reads the config file, returning an empty config if there
+// isn't one.
+func loadConfig() (*config, error) {
+	fn := os.Getenv("BRAIN_CONFIG")
+	if fn == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return &config{}, nil
+		}
+		fn = path.Join(dir, "brain", "config.json")
+	}
+
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &config{}, nil
+		}
+		return nil, err
+	}
+
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", fn, err)
+	}
+	return &c, nil
+}
+
+// resolve works out which brain directory to open and how to open it.
+// In order of precedence the directory comes from the --brain flag, the
+// --profile flag, $BRAIN_DIR, the default profile and finally ~/.brain.
+// The --store flag overrides the store set by the profile.
+func (c *config) resolve(dir, name, store string) (*target, error) {
+	var p profile
+	switch {
+	case dir != "":
+		p.Dir = dir
+	case name != "":
+		var ok bool
+		if p, ok = c.Profiles[name]; !ok {
+			return nil, fmt.Errorf("unknown profile %q", name)
+		}
+	case os.Getenv("BRAIN_DIR") != "":
+		p.Dir = os.Getenv("BRAIN_DIR")
+	case c.Default != "":
+		var ok bool
+		if p, ok = c.Profiles[c.Default]; !ok {
+			return nil, fmt.Errorf("unknown default profile %q", c.Default)
+		}
+	}
+
+	if p.Dir == "" {
+		var err error
+		if p.Dir, err = brain.DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := expandHome(p.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if store != "" {
+		p.Store = store
+	}
+
+	t := &target{dir: dir}
+	switch p.Store {
+	case "", storeData:
+	case storeMarkdown:
+		t.markdown = true
+	default:
+		return nil, fmt.Errorf("unknown store %q, expected %s or %s", p.Store, storeData, storeMarkdown)
+	}
+
+	if v := os.Getenv("BRAIN_TRASH_RETENTION"); v != "" {
+		p.TrashRetention = v
+	}
+
+	if p.TrashRetention != "" {
+		d, err := time.ParseDuration(p.TrashRetention)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trash retention: %w", err)
+		}
+		t.opts = append(t.opts, brain.WithTrashRetention(d))
+	}
+	if p.HistoryLimit != nil {
+		if *p.HistoryLimit < 0 {
+			return nil, fmt.Errorf("invalid history limit %d", *p.HistoryLimit)
+		}
+		t.opts = append(t.opts, brain.WithHistoryLimit(*p.HistoryLimit))
+	}
+	if p.Compress {
+		t.opts = append(t.opts, brain.WithCompression())
+	}
+	if p.Git {
+		t.opts = append(t.opts, brain.WithGit())
+	}
+	if p.Backup != nil {
+		every, err := time.ParseDuration(p.Backup.Every)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup interval: %w", err)
+		}
+		dir, err := expandHome(p.Backup.Dir)
+		if err != nil {
+			return nil, err
+		}
+		t.opts = append(t.opts, brain.WithBackups(brain.BackupSchedule{
+			Dir:   dir,
+			Every: every,
+			Keep:  p.Backup.Keep,
+		}))
+	}
+
+	return t, nil
+}
+
+// expandHome replaces a leading ~ in a path with the user's home directory.
+func expandHome(p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(home, p[1:]), nil
+}
@@ -1,34 +1,429 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/sno6/brain"
+	"github.com/sno6/brain/search"
 	"github.com/sno6/brain/tui"
 )
 
 func main() {
-	var arg string
-	if len(os.Args) > 1 {
-		arg = os.Args[1]
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run runs the command given on the command line. Commands return their
+// errors rather than exiting, so that the brain is always closed first.
+func run() error {
+	dirFlag := flag.String("brain", "", "path of the brain directory to use")
+	profileFlag := flag.String("profile", "", "name of a brain in the config file to use")
+	storeFlag := flag.String("store", "", "how the brain keeps its cells, either data or markdown")
+	sortFlag := flag.String("sort", "relevance", "order of the cells found by searches: relevance, newest, oldest, updated or viewed")
+	flag.Parse()
+
+	arg := flag.Arg(0)
+	var args []string
+	if flag.NArg() > 1 {
+		args = flag.Args()[1:]
+	}
+
+	order, err := search.ParseOrder(*sortFlag)
+	if err != nil {
+		return err
 	}
 
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	t, err := cfg.resolve(*dirFlag, *profileFlag, *storeFlag)
+	if err != nil {
+		return err
+	}
+
+	// Syncing needs the brain to be kept in git, which it will be from then
+	// on if it's set in the profile. Only Markdown brains can be.
+	if arg == "sync" {
+		if !t.markdown {
+			return errors.New("brain sync only works with Markdown brains, use -store markdown or a profile with \"store\": \"markdown\"")
+		}
+		t.opts = append(t.opts, brain.WithGit())
+	}
+
+	// Restoring replaces the brain, so it mustn't be open.
+	if arg == "restore" {
+		return restore(t, args)
+	}
+
+	// The index may be too damaged to open, so it's removed before the
+	// brain is opened and rebuilt afterwards.
+	if arg == "reindex" {
+		if err := brain.DropIndex(t.dir); err != nil {
+			return err
+		}
+	}
+
+	b, err := openBrain(t, arg)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
 	page := tui.PageIndex
 	switch arg {
 	case "read":
 		page = tui.PageSearch
 	case "write":
 		page = tui.PageWrite
+	case "compact":
+		return compact(b)
+	case "fsck":
+		return fsck(b, args)
+	case "reindex":
+		return reindex(b)
+	case "trash":
+		return trash(b, args)
+	case "stats":
+		return stats(b)
+	case "encrypt":
+		return encrypt(b)
+	case "decrypt":
+		return decrypt(b)
+	case "sync":
+		return sync(b, args)
+	case "backup":
+		return backup(b, args)
+	case "attach":
+		return attach(b, args)
+	}
+
+	app := tui.NewApp(b, page)
+	app.SetOrder(order)
+	return app.Start()
+}
+
+// How many times to ask for the passphrase of an encrypted brain.
+const passphraseTries = 3
+
+// openBrain opens the brain in dir for the given command, asking for its
+// passphrase if it is encrypted, unless $BRAIN_PASSPHRASE is set.
+func openBrain(t *target, arg string) (*brain.Brain, error) {
+	if !brain.Encrypted(t.dir) {
+		return open(t, arg, t.opts)
+	}
+	if pass := os.Getenv("BRAIN_PASSPHRASE"); pass != "" {
+		return open(t, arg, append(t.opts, brain.WithPassphrase(pass)))
+	}
+
+	var message string
+	for i := 0; i < passphraseTries; i++ {
+		pass, err := tui.ReadPassphrase("Unlock brain 🔒", message)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := open(t, arg, append(t.opts, brain.WithPassphrase(pass)))
+		if !errors.Is(err, brain.ErrWrongPassphrase) {
+			return b, err
+		}
+		message = "Wrong passphrase, try again."
+	}
+	return nil, brain.ErrWrongPassphrase
+}
+
+func open(t *target, arg string, opts []brain.Option) (*brain.Brain, error) {
+	openFn := brain.Open
+	if t.markdown {
+		openFn = brain.OpenMarkdown
 	}
+	b, err := openFn(t.dir, opts...)
 
-	b, err := brain.New()
+	var locked *brain.LockedError
+	if errors.As(err, &locked) && (arg == "read" || arg == "backup") {
+		// Another process is writing to the brain, but we can still
+		// search or back up what it has written so far.
+		return openFn(t.dir, append(opts, brain.ReadOnly())...)
+	}
+	return b, err
+}
+
+func compact(b *brain.Brain) error {
+	n, err := b.Compact()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	fmt.Printf("Reclaimed %d bytes.\n", n)
+	return nil
+}
 
-	app := tui.NewApp(b, page)
-	if err := app.Start(); err != nil {
-		log.Fatal(err)
+func reindex(b *brain.Brain) error {
+	n, err := b.Reindex()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reindexed %d cells.\n", n)
+	return nil
+}
+
+// errUnrepaired is returned by fsck when it finds problems but wasn't
+// asked to repair them, so that brain exits with a failure.
+var errUnrepaired = errors.New("problems found, run brain fsck -repair to fix them")
+
+func fsck(b *brain.Brain, args []string) error {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "fix the problems that are found where possible")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := b.Verify()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Checked %d records.\n", report.Records)
+	for _, id := range report.Orphans {
+		fmt.Printf("orphaned cell %s is missing from the index\n", id)
+	}
+	for _, id := range report.Unmapped {
+		fmt.Printf("cell %s is missing from the offset table\n", id)
+	}
+	for _, id := range report.Dangling {
+		fmt.Printf("dangling index entry %s has no readable cell\n", id)
+	}
+	for _, r := range report.Unparsable {
+		fmt.Printf("unparsable record at offset %d: %v\n", r.Offset, r.Err)
+	}
+	if report.TruncatedAt != 0 {
+		fmt.Printf("truncated record at offset %d\n", report.TruncatedAt)
+	}
+
+	if report.OK() {
+		return nil
+	}
+	if !*repair {
+		return errUnrepaired
+	}
+	if err := b.Repair(report); err != nil {
+		return err
+	}
+	fmt.Println("Repaired.")
+	return nil
+}
+
+func stats(b *brain.Brain) error {
+	if err := b.LastBackupError(); err != nil {
+		fmt.Printf("Backups:     failing, %v\n", err)
+	}
+
+	s, err := b.Stats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cells:       %d (%d in the trash, %d earlier revisions)\n", s.Cells, s.Trashed, s.Revisions)
+	fmt.Printf("Data file:   %s in %d records\n", byteSize(s.Size), s.Records)
+	fmt.Printf("Compression: %.2fx, %d of %d records compressed (%s stored as %s)\n",
+		s.CompressionRatio(), s.Compressed, s.Records, byteSize(s.Raw), byteSize(s.Stored))
+	return nil
+}
+
+// byteSize formats a number of bytes for people to read.
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func encrypt(b *brain.Brain) error {
+	pass, err := tui.ReadPassphrase("New passphrase 🔒", "")
+	if err != nil {
+		return err
+	}
+	again, err := tui.ReadPassphrase("Repeat passphrase 🔒", "")
+	if err != nil {
+		return err
+	}
+	if pass != again {
+		return errors.New("passphrases don't match")
+	}
+
+	if err := b.Encrypt(pass); err != nil {
+		return err
+	}
+	fmt.Println("Encrypted.")
+	return nil
+}
+
+func decrypt(b *brain.Brain) error {
+	if err := b.Decrypt(); err != nil {
+		return err
+	}
+	fmt.Println("Decrypted.")
+	return nil
+}
+
+func backup(b *brain.Brain, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: brain backup <file.tar.gz>")
+	}
+	if err := b.BackupFile(args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Backed up to %s.\n", args[0])
+	return nil
+}
+
+// attach attaches a file to a cell, which is given by its identifier or
+// by anything a [[link]] to it could be.
+func attach(b *brain.Brain, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: brain attach <cell> <file>")
+	}
+
+	cell, err := b.ResolveLink(args[0])
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := b.Attach(cell.Identifier(), filepath.Base(args[1]), f); err != nil {
+		return err
+	}
+	fmt.Printf("Attached %s.\n", filepath.Base(args[1]))
+	return nil
+}
+
+// restore replaces the brain with a backup, asking for the backup's
+// passphrase if it is of an encrypted brain, unless $BRAIN_PASSPHRASE is
+// set.
+func restore(t *target, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: brain restore <file.tar.gz>")
+	}
+
+	err := brain.RestoreBackup(args[0], t.dir, brain.WithPassphrase(os.Getenv("BRAIN_PASSPHRASE")))
+	var message string
+	for i := 0; i < passphraseTries && isPassphraseErr(err); i++ {
+		if errors.Is(err, brain.ErrWrongPassphrase) {
+			message = "Wrong passphrase, try again."
+		}
+
+		var pass string
+		if pass, err = tui.ReadPassphrase("Unlock backup 🔒", message); err != nil {
+			break
+		}
+		err = brain.RestoreBackup(args[0], t.dir, brain.WithPassphrase(pass))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s from %s.\n", t.dir, args[0])
+	return nil
+}
+
+func isPassphraseErr(err error) bool {
+	return errors.Is(err, brain.ErrPassphraseRequired) || errors.Is(err, brain.ErrWrongPassphrase)
+}
+
+func sync(b *brain.Brain, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: brain -store markdown sync push|pull [remote]")
+	}
+	var remote string
+	if len(args) > 1 {
+		remote = args[1]
+	}
+
+	switch args[0] {
+	case "push":
+		if err := b.Push(remote); err != nil {
+			return err
+		}
+		fmt.Println("Pushed.")
+	case "pull":
+		conflicts, err := b.Pull(remote)
+		if err != nil {
+			return err
+		}
+		for _, c := range conflicts {
+			fmt.Printf("conflicting changes to %s\n", c.Path)
+		}
+		if len(conflicts) > 0 {
+			fmt.Println("Kept your changes, open brain to resolve the conflicts.")
+			return nil
+		}
+		fmt.Println("Pulled.")
+	default:
+		return fmt.Errorf("unknown sync command %q, expected push or pull", args[0])
+	}
+	return nil
+}
+
+func trash(b *brain.Brain, args []string) error {
+	var sub string
+	if len(args) > 0 {
+		sub = args[0]
+	}
+
+	switch sub {
+	case "", "list":
+		cells, err := b.Trash()
+		if err != nil {
+			return err
+		}
+		for _, c := range cells {
+			fmt.Printf("%s  %s  %s\n", c.Identifier(), c.TrashedAt().Format("02/01/2006 15:04"), firstLine(c.Data()))
+		}
+	case "restore":
+		if len(args) < 2 {
+			return errors.New("usage: brain trash restore <id>...")
+		}
+		for _, id := range args[1:] {
+			if err := b.Restore(id); err != nil {
+				return fmt.Errorf("%s: %v", id, err)
+			}
+		}
+	case "empty":
+		n, err := b.EmptyTrash()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Purged %d cells.\n", n)
+	default:
+		return fmt.Errorf("unknown trash command %q, expected list, restore or empty", sub)
+	}
+	return nil
+}
+
+// How many characters of a cell to print when listing cells.
+const previewLength = 70
+
+func firstLine(data string) string {
+	if nl := strings.Index(data, "\n"); nl > -1 {
+		data = data[:nl]
+	}
+	if len(data) > previewLength {
+		data = data[:previewLength] + "..."
 	}
+	return data
 }
@@ -0,0 +1,110 @@
+package brain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+)
+
+// Payloads smaller than this aren't worth compressing, the gzip header
+// alone takes up most of what could be saved.
+const minCompressSize = 256
+
+// WithCompression compresses cells as they are written, which pays off
+// for long cells such as pasted logs and articles. Records are flagged as
+// compressed or not, so cells written before compression was turned on,
+// or after it is turned off, are read all the same.
+func WithCompression() Option {
+	return func(b *Brain) {
+		b.compress = true
+	}
+}
+
+// A codec encodes the payloads of records as they are written to .data,
+// and decodes them as they are read back.
+type codec struct {
+	// key seals payloads if the brain is encrypted.
+	key *key
+
+	// compress is set to compress payloads that are worth compressing.
+	compress bool
+}
+
+// codec returns the codec for the records the store writes.
+func (s *fileStore) codec() codec {
+	return codec{key: s.key, compress: s.compress}
+}
+
+// encode returns an encoded payload along with the record flags that
+// describe how it was encoded.
+func (enc codec) encode(payload []byte) (uint8, []byte, error) {
+	var flags uint8
+
+	if enc.compress && len(payload) >= minCompressSize {
+		compressed, err := compress(payload)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(compressed) < len(payload) {
+			payload = compressed
+			flags |= flagCompressed
+		}
+	}
+
+	if enc.key != nil {
+		sealed, err := enc.key.seal(payload)
+		if err != nil {
+			return 0, nil, err
+		}
+		payload = sealed
+		flags |= flagSealed
+	}
+
+	return flags, payload, nil
+}
+
+// decode reverses encode, going by the flags rather than the codec's own
+// settings so that any record can be decoded. Sealed records can only be
+// decoded with a key.
+func (enc codec) decode(flags uint8, payload []byte) ([]byte, error) {
+	var err error
+
+	if flags&flagSealed != 0 {
+		if enc.key == nil {
+			return nil, ErrPassphraseRequired
+		}
+		if payload, err = enc.key.open(payload); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptRecord, err)
+		}
+	}
+
+	if flags&flagCompressed != 0 {
+		if payload, err = decompress(payload); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptRecord, err)
+		}
+	}
+
+	return payload, nil
+}
+
+func compress(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(payload []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,333 @@
+package brain
+
+import (
+	"os"
+	"path"
+	"sort"
+
+	"github.com/sno6/brain/search"
+)
+
+const (
+	compactDataFn  = ".data.compact"
+	compactTableFn = ".offsets.compact"
+
+	// compactionKey is set in the index's internal store in the same batch
+	// that re-keys documents, marking that the compacted files are ready
+	// to replace .data and .offsets.
+	compactionKey = "compaction"
+)
+
+// Compact rewrites the .data file so that it only contains cells that are
+// live or in the trash, along with their most recent earlier revisions up
+// to the history limit, see WithHistoryLimit, reclaiming the space held
+// by purged cells and older revisions. Which cells those are is found by
+// replaying .data, so cells missing from the index are kept, and indexed,
+// while corrupt records are dropped. Cells that have been in the trash
+// for longer than the retention period are purged first. It returns the
+// number of bytes reclaimed.
+//
+// Files attached only to the earlier revisions that are dropped are
+// removed along with them.
+//
+// Legacy cells are given stable identifiers as they are copied, and their
+// offset:size identifiers are kept as aliases so that they still resolve.
+// The extra bytes this takes can make the result negative.
+//
+// Live cells are copied to temporary files and every migrated cell is
+// re-keyed in a single index batch, which also records that a compaction
+// is pending. Only then are the temporary files swapped in. If we are
+// interrupted, New either finishes the swap or throws the temporary files
+// away, depending on whether the batch made it to the index.
+func (b *Brain) Compact() (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return 0, ErrReadOnly
+	}
+	fs, err := b.file()
+	if err != nil {
+		return 0, err
+	}
+	return b.compact(fs.codec())
+}
+
+// compact compacts .data, encoding the records it writes with enc. The
+// brain must keep its cells in .data.
+func (b *Brain) compact(enc codec) (int64, error) {
+	before, err := size(b.fs.data)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := b.purgeExpired(); err != nil {
+		return 0, err
+	}
+
+	replayed, err := b.fs.replay(&Report{})
+	if err != nil {
+		return 0, err
+	}
+	cells := withHistory(replayed, b.historyLimit)
+
+	// Cells we were interrupted while writing are indexed along the way.
+	indexed, err := b.indexedIDs()
+	if err != nil {
+		return 0, err
+	}
+	var orphans []*Cell
+	for id, rc := range replayed {
+		if rc.indexed() && !indexed[id] {
+			orphans = append(orphans, rc.cell)
+		}
+	}
+
+	after, err := b.rewriteData(cells, orphans, enc)
+	if err != nil {
+		return 0, err
+	}
+
+	// The earlier revisions that were dropped may have been the last to
+	// have some files attached.
+	if err := b.removeUnusedBlobs(); err != nil {
+		return 0, err
+	}
+	return before - after, nil
+}
+
+// rewriteData replaces .data with one holding just the given cells, in the
+// order they are in now, and indexes the orphans among them. It returns
+// the size of the new .data.
+func (b *Brain) rewriteData(cells, orphans []*Cell, enc codec) (int64, error) {
+	sort.Slice(cells, func(i, j int) bool {
+		return cells[i].offset < cells[j].offset
+	})
+
+	dataPath := path.Join(b.dir, compactDataFn)
+	tablePath := path.Join(b.dir, compactTableFn)
+	discard := func() {
+		os.Remove(dataPath)
+		os.Remove(tablePath)
+	}
+
+	data, err := createTemp(dataPath)
+	if err != nil {
+		return 0, err
+	}
+	table, err := createTemp(tablePath)
+	if err != nil {
+		data.Close()
+		discard()
+		return 0, err
+	}
+
+	batch, after, err := b.copyLiveCells(data, table, cells, enc)
+	for _, c := range orphans {
+		if err == nil {
+			err = batch.Index(c.id, b.document(c))
+		}
+	}
+	for _, f := range []*os.File{data, table} {
+		if err == nil {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		discard()
+		return 0, err
+	}
+
+	batch.SetInternal(compactionKey, []byte{1})
+	if err := batch.Commit(); err != nil {
+		discard()
+		return 0, err
+	}
+
+	if err := b.finishCompaction(); err != nil {
+		return 0, err
+	}
+	b.forgetSuccessors()
+	return after, nil
+}
+
+// copyLiveCells writes the given cells to data back to back after a file
+// header, following any cell in the trash with its tombstone, and records
+// their new locations in table. It returns a batch that moves the index
+// entries of migrated legacy cells to their new identifiers, along with
+// the number of bytes written to data. Records are encoded with enc.
+func (b *Brain) copyLiveCells(data, table *os.File, cells []*Cell, enc codec) (*search.Batch, int64, error) {
+	batch := b.search.NewBatch()
+
+	aliases := make(map[string]string, len(b.fs.table.aliases))
+	for legacy, stable := range b.fs.table.aliases {
+		aliases[stable] = legacy
+	}
+
+	if err := writeHeader(data); err != nil {
+		return nil, 0, err
+	}
+
+	offset := headerSize
+	for _, cell := range cells {
+		if cell.id == "" {
+			// A legacy cell is known by its offset:size identifier until
+			// it is given a stable one.
+			cell.id = newID()
+			aliases[cell.id] = cell.legacyID
+
+			batch.Delete(cell.legacyID)
+			if err := batch.Index(cell.id, b.document(cell)); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if legacy := aliases[cell.id]; legacy != "" {
+			cell.legacyID = legacy
+		}
+		cell.offset = offset
+		buf, err := cell.marshal(enc)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := data.Write(buf); err != nil {
+			return nil, 0, err
+		}
+
+		loc := location{offset: offset, size: int64(len(buf))}
+		if _, err := writeTableEntry(table, cell.id, loc, cell.legacyID); err != nil {
+			return nil, 0, err
+		}
+		offset += loc.size
+
+		if cell.trashed == 0 {
+			continue
+		}
+
+		if buf, err = marker(kindTombstone, cell.id, cell.trashed, enc); err != nil {
+			return nil, 0, err
+		}
+		if _, err := data.Write(buf); err != nil {
+			return nil, 0, err
+		}
+		if _, err := writeTrashEntry(table, cell.id, cell.trashed); err != nil {
+			return nil, 0, err
+		}
+		offset += int64(len(buf))
+	}
+
+	return batch, offset, nil
+}
+
+// withHistory returns the replayed cells that are live, including those in
+// the trash, along with up to limit of their most recent earlier revisions,
+// or all of them if limit is 0. Revisions of cells that have been purged
+// are left out.
+func withHistory(replayed map[string]*replayedCell, limit int) []*Cell {
+	var cells []*Cell
+	for _, rc := range replayed {
+		if !rc.live {
+			continue
+		}
+
+		var history []*Cell
+		for c := rc.cell; ; {
+			history = append(history, c)
+			prev, ok := replayed[c.supersedes]
+			if !ok || prev.live {
+				break
+			}
+			c = prev.cell
+		}
+
+		if limit > 0 && len(history) > limit+1 {
+			// The oldest revision that is kept remembers when the cell
+			// was first written, in place of those that are dropped.
+			first := history[len(history)-1]
+			created := first.created
+			if created == 0 {
+				created = first.ts
+			}
+			history = history[:limit+1]
+			history[limit].created = created
+		}
+		cells = append(cells, history...)
+	}
+	return cells
+}
+
+// readCells reads the cells with the given identifiers, along with every
+// earlier revision of them, from the offset table. Legacy cells keep the
+// identifier they were read by as their legacy one.
+func (b *Brain) readCells(ids []string) ([]*Cell, error) {
+	var cells []*Cell
+	for _, id := range ids {
+		history, err := b.history(id)
+		if err != nil {
+			return nil, err
+		}
+		if history[0].id == "" {
+			history[0].legacyID = id
+		}
+		cells = append(cells, history...)
+	}
+	return cells, nil
+}
+
+// recoverCompaction cleans up after a compaction that was interrupted.
+func (b *Brain) recoverCompaction() error {
+	pending, err := b.search.Internal(compactionKey)
+	if err != nil {
+		return err
+	}
+
+	if pending != nil {
+		return b.finishCompaction()
+	}
+
+	// The index was never re-keyed, so the old files are still the truth.
+	for _, fn := range []string{compactDataFn, compactTableFn} {
+		err := os.Remove(path.Join(b.dir, fn))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishCompaction swaps the compacted files in for .data and .offsets,
+// reopens them and clears the pending compaction marker.
+func (b *Brain) finishCompaction() error {
+	renames := map[string]string{
+		compactDataFn:  dataFn,
+		compactTableFn: tableFn,
+	}
+	for from, to := range renames {
+		err := os.Rename(path.Join(b.dir, from), path.Join(b.dir, to))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	data, err := openData(b.dir)
+	if err != nil {
+		return err
+	}
+	table, err := openTable(b.dir)
+	if err != nil {
+		data.Close()
+		return err
+	}
+	b.fs.data.Close()
+	b.fs.table.close()
+	b.fs.data, b.fs.table = data, table
+
+	return b.search.DeleteInternal(compactionKey)
+}
+
+func createTemp(fn string) (*os.File, error) {
+	return os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+}
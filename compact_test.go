@@ -0,0 +1,191 @@
+package brain
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+)
+
+// writeCell writes a cell to the brain and returns its identifier.
+func writeCell(t *testing.T, b *Brain, s string) string {
+	t.Helper()
+
+	before, err := b.indexedIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(s); err != nil {
+		t.Fatal(err)
+	}
+	after, err := b.indexedIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := range after {
+		if !before[id] {
+			return id
+		}
+	}
+	t.Fatalf("writing %q didn't index a new cell", s)
+	return ""
+}
+
+// openCompactable opens a new brain holding a live cell, which it returns
+// the identifier of, and a purged one for compaction to drop.
+func openCompactable(t *testing.T) (*Brain, string) {
+	t.Helper()
+
+	b, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keep := writeCell(t, b, "keep")
+	purged := writeCell(t, b, "purged")
+	if err := b.Delete(purged); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Purge(purged); err != nil {
+		t.Fatal(err)
+	}
+	return b, keep
+}
+
+// interruptCompaction runs a compaction as far as writing the compacted
+// files, and committing the index batch that marks them ready if commit is
+// set, then closes the brain as if it had been interrupted.
+func interruptCompaction(t *testing.T, b *Brain, commit bool) {
+	t.Helper()
+
+	replayed, err := b.fs.replay(&Report{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := createTemp(path.Join(b.dir, compactDataFn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := createTemp(path.Join(b.dir, compactTableFn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, _, err := b.copyLiveCells(data, table, withHistory(replayed, b.historyLimit), b.fs.codec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Close()
+	table.Close()
+
+	if commit {
+		batch.SetInternal(compactionKey, []byte{1})
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkRecovered reopens the brain in dir and checks that the cell with
+// the given identifier survived, that .data holds the given number of
+// records, and that nothing is left of the interrupted compaction.
+func checkRecovered(t *testing.T, dir, keep string, records int) {
+	t.Helper()
+
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer b.Close()
+
+	if c, err := b.Read(keep); err != nil || c.Data() != "keep" {
+		t.Errorf("Read(%s) = %v, want %q", keep, err, "keep")
+	}
+	stats, err := b.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Records != records {
+		t.Errorf(".data holds %d records, want %d", stats.Records, records)
+	}
+	if pending, err := b.search.Internal(compactionKey); err != nil || pending != nil {
+		t.Errorf("compaction marker = %v, %v, want it cleared", pending, err)
+	}
+	for _, fn := range []string{compactDataFn, compactTableFn} {
+		if _, err := os.Stat(path.Join(dir, fn)); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", fn, err)
+		}
+	}
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("Verify() = %+v, want a consistent brain", report)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	b, keep := openCompactable(t)
+	dir := b.dir
+
+	reclaimed, err := b.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed <= 0 {
+		t.Errorf("Compact() reclaimed %d bytes, want some", reclaimed)
+	}
+	b.Close()
+
+	checkRecovered(t, dir, keep, 1)
+}
+
+func TestRecoverCompactionBeforeCommit(t *testing.T) {
+	b, keep := openCompactable(t)
+	dir := b.dir
+	before, err := os.ReadFile(path.Join(dir, dataFn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interruptCompaction(t, b, false)
+	checkRecovered(t, dir, keep, 4)
+
+	after, err := os.ReadFile(path.Join(dir, dataFn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error(".data changed by a compaction that was never committed")
+	}
+}
+
+func TestRecoverCompactionAfterCommit(t *testing.T) {
+	tests := []struct {
+		name    string
+		renamed []string
+	}{
+		{"nothing renamed", nil},
+		{"data renamed", []string{compactDataFn}},
+		{"table renamed", []string{compactTableFn}},
+		{"both renamed", []string{compactDataFn, compactTableFn}},
+	}
+	renames := map[string]string{compactDataFn: dataFn, compactTableFn: tableFn}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, keep := openCompactable(t)
+			dir := b.dir
+
+			interruptCompaction(t, b, true)
+			for _, fn := range tt.renamed {
+				if err := os.Rename(path.Join(dir, fn), path.Join(dir, renames[fn])); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkRecovered(t, dir, keep, 1)
+		})
+	}
+}
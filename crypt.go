@@ -0,0 +1,293 @@
+package brain
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/sno6/brain/search"
+)
+
+const (
+	keyFn = ".key"
+
+	// scrypt parameters for deriving a key from a passphrase.
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	keySize      = 32
+	keySaltSize  = 16
+	keyCheckText = "brain"
+)
+
+var (
+	// ErrPassphraseRequired is returned when opening an encrypted brain
+	// without a passphrase, see WithPassphrase.
+	ErrPassphraseRequired = errors.New("brain is encrypted, a passphrase is required")
+
+	// ErrWrongPassphrase is returned when the passphrase given for an
+	// encrypted brain doesn't match the one it was encrypted with.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+
+	// ErrNotEncrypted is returned when a passphrase is given for a brain
+	// that isn't encrypted, or when decrypting it.
+	ErrNotEncrypted = errors.New("brain is not encrypted")
+
+	// ErrAlreadyEncrypted is returned when encrypting a brain that is
+	// already encrypted.
+	ErrAlreadyEncrypted = errors.New("brain is already encrypted")
+)
+
+// WithPassphrase sets the passphrase used to unlock an encrypted brain.
+// Only brains that keep their cells in .data can be encrypted, see
+// OpenMarkdown and OpenStore.
+func WithPassphrase(passphrase string) Option {
+	return func(b *Brain) {
+		b.passphrase = passphrase
+	}
+}
+
+// Encrypted reports whether the brain in the given folder is encrypted,
+// and so needs a passphrase to open.
+func Encrypted(dir string) bool {
+	_, err := os.Stat(path.Join(dir, keyFn))
+	return err == nil
+}
+
+// A key seals and opens the payloads of records in an encrypted brain.
+type key struct {
+	aead cipher.AEAD
+}
+
+// keyFile is how the parameters for deriving a brain's key from its
+// passphrase are stored in .key. The key itself is never stored, check is
+// a known value sealed with it so that a wrong passphrase can be told
+// apart from corrupt records.
+type keyFile struct {
+	KDF   string `json:"kdf"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Salt  []byte `json:"salt"`
+	Check []byte `json:"check"`
+}
+
+// newKey derives a fresh key from the given passphrase, returning it
+// along with the key file to store for it.
+func newKey(passphrase string) (*key, *keyFile, error) {
+	kf := &keyFile{
+		KDF:  "scrypt",
+		N:    scryptN,
+		R:    scryptR,
+		P:    scryptP,
+		Salt: make([]byte, keySaltSize),
+	}
+	if _, err := io.ReadFull(rand.Reader, kf.Salt); err != nil {
+		return nil, nil, err
+	}
+
+	k, err := kf.derive(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	if kf.Check, err = k.seal([]byte(keyCheckText)); err != nil {
+		return nil, nil, err
+	}
+	return k, kf, nil
+}
+
+// loadKey reads the key file in the given directory and derives the key
+// from the passphrase. It returns a nil key if the brain isn't encrypted.
+func loadKey(dir, passphrase string) (*key, error) {
+	buf, err := ioutil.ReadFile(path.Join(dir, keyFn))
+	if os.IsNotExist(err) {
+		if passphrase != "" {
+			return nil, ErrNotEncrypted
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+
+	var kf keyFile
+	if err := json.Unmarshal(buf, &kf); err != nil {
+		return nil, fmt.Errorf("invalid key file: %w", err)
+	}
+	if kf.KDF != "scrypt" {
+		return nil, fmt.Errorf("invalid key file: unknown kdf %q", kf.KDF)
+	}
+
+	k, err := kf.derive(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := k.open(kf.Check); err != nil || string(check) != keyCheckText {
+		return nil, ErrWrongPassphrase
+	}
+	return k, nil
+}
+
+func (kf *keyFile) derive(passphrase string) (*key, error) {
+	dk, err := scrypt.Key([]byte(passphrase), kf.Salt, kf.N, kf.R, kf.P, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &key{aead: aead}, nil
+}
+
+// write stores the key file in the given directory, replacing any that is
+// already there.
+func (kf *keyFile) write(dir string) error {
+	buf, err := json.Marshal(kf)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path.Join(dir, keyFn+".new")
+	if err := ioutil.WriteFile(tmpPath, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path.Join(dir, keyFn))
+}
+
+// seal encrypts and authenticates a payload, prefixing it with a random
+// nonce.
+func (k *key) seal(payload []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, payload, nil), nil
+}
+
+// open reverses seal.
+func (k *key) open(sealed []byte) ([]byte, error) {
+	n := k.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("sealed payload too short")
+	}
+	return k.aead.Open(nil, sealed[:n], sealed[n:], nil)
+}
+
+// Encrypt encrypts the brain with a key derived from the given
+// passphrase, which is needed to open it from then on.
+//
+// Every record in .data is rewritten sealed by a compaction, and the
+// index on disk is thrown away, since an encrypted brain only keeps its
+// index in memory. Records are flagged as sealed or not, so a brain that
+// is only partly encrypted when we are interrupted can still be read, and
+// the records left unsealed are sealed by its next compaction.
+func (b *Brain) Encrypt(passphrase string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	fs, err := b.file()
+	if err != nil {
+		return err
+	}
+	if fs.key != nil {
+		return ErrAlreadyEncrypted
+	}
+	if passphrase == "" {
+		return errors.New("passphrase can't be empty")
+	}
+	if attached, err := b.hasBlobs(); err != nil || attached {
+		if err == nil {
+			err = fmt.Errorf("%w: attachments can't be encrypted", ErrNotSupported)
+		}
+		return err
+	}
+
+	k, kf, err := newKey(passphrase)
+	if err != nil {
+		return err
+	}
+	if err := kf.write(b.dir); err != nil {
+		return err
+	}
+
+	fs.key = k
+	if _, err := b.compact(fs.codec()); err != nil {
+		return err
+	}
+	return b.useMemIndex()
+}
+
+// Decrypt turns an encrypted brain back into a plain one, rewriting every
+// record in .data unsealed and storing its index on disk again.
+func (b *Brain) Decrypt() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	fs, err := b.file()
+	if err != nil {
+		return err
+	}
+	if fs.key == nil {
+		return ErrNotEncrypted
+	}
+
+	if _, err := b.compact(codec{compress: fs.compress}); err != nil {
+		return err
+	}
+	fs.key = nil
+
+	s, err := search.New(b.dir)
+	if err != nil {
+		return err
+	}
+	b.search.Close()
+	b.search = s
+	if _, err := b.reindex(); err != nil {
+		return err
+	}
+
+	// Until the key file is gone the brain is still opened as encrypted,
+	// which is harmless, as every record is readable without the key.
+	return os.Remove(path.Join(b.dir, keyFn))
+}
+
+// useMemIndex replaces the index on disk with one that is only kept in
+// memory, which is built by replaying .data.
+func (b *Brain) useMemIndex() error {
+	s, err := search.NewMemOnly()
+	if err != nil {
+		return err
+	}
+	if b.search != nil {
+		b.search.Close()
+	}
+	b.search = s
+	if err := search.Remove(b.dir); err != nil {
+		return err
+	}
+	_, err = b.reindex()
+	return err
+}
@@ -0,0 +1,68 @@
+package brain
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := writeCell(t, b, "the secret plans")
+	if err := b.Encrypt("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path.Join(dir, dataFn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret")) {
+		t.Error(".data still holds the cell in plaintext")
+	}
+	if !Encrypted(dir) {
+		t.Error("brain isn't reported as encrypted")
+	}
+
+	if _, err := Open(dir); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("opening without a passphrase = %v, want ErrPassphraseRequired", err)
+	}
+	if _, err := Open(dir, WithPassphrase("hunter3")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("opening with the wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+
+	b, err = Open(dir, WithPassphrase("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := b.Read(id); err != nil || c.Data() != "the secret plans" {
+		t.Fatalf("reading encrypted cell: %v, %v", c, err)
+	}
+	if err := b.Decrypt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if Encrypted(dir) {
+		t.Error("brain is still reported as encrypted")
+	}
+	b, err = Open(dir)
+	if err != nil {
+		t.Fatalf("opening decrypted brain: %v", err)
+	}
+	defer b.Close()
+	if c, err := b.Read(id); err != nil || c.Data() != "the secret plans" {
+		t.Errorf("reading decrypted cell: %v, %v", c, err)
+	}
+}
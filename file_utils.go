@@ -14,27 +14,25 @@ func size(f *os.File) (int64, error) {
 	return stat.Size(), nil
 }
 
-// Create FS resources if they don't yet exist.
-func initBrain() (*os.File, string, error) {
+// DefaultDir returns the path of the brain directory used by New, which
+// is ~/.brain.
+func DefaultDir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return nil, "", err
+		return "", err
 	}
+	return path.Join(home, brainDir), nil
+}
 
-	dir := path.Join(home, brainDir)
-	if _, err = os.Stat(dir); err != nil && os.IsNotExist(err) {
-		// First time running.. init resources.
-		if err := os.Mkdir(dir, os.ModePerm); err != nil {
-			return nil, "", err
-		}
-		if _, err := os.Create(path.Join(dir, dataFn)); err != nil {
-			return nil, "", err
-		}
+// Create FS resources in the given directory if they don't yet exist.
+func initBrain(dir string) (*os.File, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
 	}
+	return os.OpenFile(path.Join(dir, dataFn), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0755)
+}
 
-	f, err := os.OpenFile(path.Join(dir, dataFn), os.O_RDWR|os.O_APPEND, 0755)
-	if err != nil {
-		return nil, "", err
-	}
-	return f, dir, nil
+// openData opens the .data file in the given brain directory for appending.
+func openData(dir string) (*os.File, error) {
+	return os.OpenFile(path.Join(dir, dataFn), os.O_RDWR|os.O_APPEND, 0755)
 }
@@ -0,0 +1,202 @@
+package brain
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// A fileStore is the Store used by Open, which keeps cells in the
+// append-only .data file. Cells are never changed in place: edits append
+// a new revision, and moving cells to and from the trash or purging them
+// appends a record saying so, which makes .data the source of truth for
+// the state of every cell. The offset table maps each cell to where its
+// record lives, and keeps track of the trash.
+type fileStore struct {
+	dir   string
+	data  *os.File
+	table *offsetTable
+
+	// key seals every record written to .data if the brain is encrypted.
+	key *key
+
+	// compress is set to compress cells as they are written.
+	compress bool
+
+	// legacy is set while .data is still in the unframed format used by
+	// earlier versions, which is only the case until it is migrated.
+	legacy bool
+
+	// snapshotSize is how much of .data a read-only snapshot of the brain
+	// covers, up to the end of its last whole record.
+	snapshotSize int64
+}
+
+// openFileStore opens the .data file and offset table in the given
+// directory, creating them if they don't exist yet.
+func openFileStore(dir, passphrase string, compress bool) (*fileStore, error) {
+	data, err := initBrain(dir)
+	if err != nil {
+		return nil, err
+	}
+	k, err := loadKey(dir, passphrase)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	table, err := openTable(dir)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+
+	return &fileStore{
+		dir:      dir,
+		data:     data,
+		table:    table,
+		key:      k,
+		compress: compress,
+	}, nil
+}
+
+// Append writes the cell's record to the end of .data, which becomes its
+// offset. Writers hold the brain's lock, so nothing else can append to
+// .data between taking its size and writing the record.
+func (s *fileStore) Append(c *Cell) error {
+	offset, err := size(s.data)
+	if err != nil {
+		return err
+	}
+	c.offset = offset
+
+	buf, err := c.marshal(s.codec())
+	if err != nil {
+		return err
+	}
+	if _, err := s.data.Write(buf); err != nil {
+		return err
+	}
+	return s.table.add(c.id, location{offset: offset, size: int64(len(buf))})
+}
+
+// Read reads a cell from .data by a given identifier.
+//
+// The identifier is either a cell's stable identifier or, for cells written
+// before stable identifiers existed, its legacy offset:size identifier.
+func (s *fileStore) Read(id string) (*Cell, error) {
+	loc, err := s.locate(id)
+	if err != nil {
+		return nil, err
+	}
+	cell, err := s.readCell(loc)
+	if err != nil {
+		return nil, err
+	}
+	cell.trashed, _ = s.table.trashedAt(cell.id)
+	return cell, nil
+}
+
+// Iterate replays .data and calls fn with every cell that hasn't been
+// purged.
+func (s *fileStore) Iterate(fn func(*Cell) error) error {
+	cells, err := s.replay(&Report{})
+	if err != nil {
+		return err
+	}
+
+	sorted := make([]*replayedCell, 0, len(cells))
+	for _, rc := range cells {
+		sorted = append(sorted, rc)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].loc.offset < sorted[j].loc.offset
+	})
+
+	for _, rc := range sorted {
+		if err := fn(rc.cell); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete appends a purge record for the cell. Its data is dropped from
+// .data at the next compaction.
+func (s *fileStore) Delete(id string) error {
+	if err := s.appendMarker(kindPurge, id, time.Now().UTC().Unix()); err != nil {
+		return err
+	}
+	return s.table.remove(id)
+}
+
+// SetTrashed appends a tombstone for a cell that is moved to the trash,
+// or a restore record for one that is taken back out.
+func (s *fileStore) SetTrashed(id string, ts int64) error {
+	if ts == 0 {
+		if err := s.appendMarker(kindRestore, id, time.Now().UTC().Unix()); err != nil {
+			return err
+		}
+		return s.table.restore(id)
+	}
+
+	if err := s.appendMarker(kindTombstone, id, ts); err != nil {
+		return err
+	}
+	return s.table.moveToTrash(id, ts)
+}
+
+// Trashed returns when each cell in the trash was moved there.
+func (s *fileStore) Trashed() (map[string]int64, error) {
+	trash := make(map[string]int64, len(s.table.trash))
+	for id, ts := range s.table.trash {
+		trash[id] = ts
+	}
+	return trash, nil
+}
+
+// Close closes .data and the offset table.
+func (s *fileStore) Close() error {
+	if err := s.data.Close(); err != nil {
+		return err
+	}
+	return s.table.close()
+}
+
+func (s *fileStore) appendMarker(kind, id string, ts int64) error {
+	buf, err := marker(kind, id, ts, s.codec())
+	if err != nil {
+		return err
+	}
+	_, err = s.data.Write(buf)
+	return err
+}
+
+// locate finds where the cell with the given identifier lives in .data.
+func (s *fileStore) locate(id string) (location, error) {
+	id = s.table.resolve(id)
+	if loc, ok := s.table.lookup(id); ok {
+		return loc, nil
+	}
+	if !s.legacy || !isLegacyIdentifier(id) {
+		return location{}, fmt.Errorf("%w %q", ErrUnknownCell, id)
+	}
+
+	offset, sz, err := parseIdentifier(id)
+	if err != nil {
+		return location{}, err
+	}
+	return location{offset: offset, size: sz}, nil
+}
+
+func (s *fileStore) readCell(loc location) (*Cell, error) {
+	buf := make([]byte, loc.size)
+	_, err := s.data.ReadAt(buf, loc.offset)
+	if err != nil {
+		return nil, err
+	}
+	if s.legacy {
+		return parseLegacyCell(loc.offset, string(buf))
+	}
+	return parseCell(loc.offset, buf, s.codec())
+}
@@ -0,0 +1,220 @@
+package brain
+
+import (
+	"errors"
+	"sort"
+)
+
+// A RecordError describes a record in .data that failed validation.
+type RecordError struct {
+	Offset int64
+	Err    error
+}
+
+// A Report lists the inconsistencies Verify found between .data, the
+// offset table and the index.
+type Report struct {
+	// Records is the number of records that were checked.
+	Records int
+
+	// Orphans are cells that are live in .data but missing from the
+	// index, usually because we were interrupted while writing them.
+	Orphans []string
+
+	// Unmapped are cells or earlier revisions of cells whose offset table
+	// entry is missing, points somewhere else or disagrees about whether
+	// the cell is in the trash.
+	Unmapped []string
+
+	// Dangling are index entries for cells that aren't live, are in the
+	// trash or can't be read.
+	Dangling []string
+
+	// Unparsable are records that are corrupt.
+	Unparsable []RecordError
+
+	// TruncatedAt is the offset of a record that was only partially
+	// written at the end of .data, or 0 if there is none.
+	TruncatedAt int64
+
+	cells map[string]*replayedCell
+}
+
+// OK reports whether no problems were found.
+func (r *Report) OK() bool {
+	return len(r.Orphans) == 0 &&
+		len(r.Unmapped) == 0 &&
+		len(r.Dangling) == 0 &&
+		len(r.Unparsable) == 0 &&
+		r.TruncatedAt == 0
+}
+
+// Verify replays every record in .data to find the live cells and
+// cross-checks them against the offset table and the index.
+func (b *Brain) Verify() (*Report, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	fs, err := b.file()
+	if err != nil {
+		return nil, err
+	}
+
+	indexed, err := b.indexedIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	report.cells, err = fs.replay(report)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, rc := range report.cells {
+		if rc.indexed() && !indexed[id] {
+			report.Orphans = append(report.Orphans, id)
+		}
+
+		loc, ok := fs.table.lookup(id)
+		trashed, _ := fs.table.trashedAt(id)
+		if !ok || loc != rc.loc || trashed != rc.cell.trashed {
+			report.Unmapped = append(report.Unmapped, id)
+		}
+	}
+	for id := range indexed {
+		if rc, ok := report.cells[id]; !ok || !rc.indexed() {
+			report.Dangling = append(report.Dangling, id)
+		}
+	}
+
+	sort.Strings(report.Orphans)
+	sort.Strings(report.Unmapped)
+	sort.Strings(report.Dangling)
+
+	return report, nil
+}
+
+// Repair fixes the problems in a report from Verify where it can. Orphans
+// are indexed, the offset table is brought up to date, dangling entries
+// are removed and a truncated record at the end of .data is cut off.
+// Corrupt records are left in place and dropped at the next compaction.
+func (b *Brain) Repair(r *Report) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	fs, err := b.file()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range r.Unmapped {
+		rc := r.cells[id]
+		if err := fs.table.add(id, rc.loc); err != nil {
+			return err
+		}
+
+		var err error
+		if _, ok := fs.table.trashedAt(id); ok && rc.cell.trashed == 0 {
+			err = fs.table.restore(id)
+		} else if rc.cell.trashed != 0 {
+			err = fs.table.moveToTrash(id, rc.cell.trashed)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	batch := b.search.NewBatch()
+	for _, id := range r.Orphans {
+		if err := batch.Index(id, b.document(r.cells[id].cell)); err != nil {
+			return err
+		}
+	}
+	for _, id := range r.Dangling {
+		// Earlier revisions stay in the offset table for their history.
+		if _, ok := r.cells[id]; !ok {
+			if err := fs.table.remove(id); err != nil {
+				return err
+			}
+		}
+		batch.Delete(id)
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+
+	if r.TruncatedAt != 0 {
+		return fs.data.Truncate(r.TruncatedAt)
+	}
+	return nil
+}
+
+// walkRecords calls fn with every valid record in .data and where it
+// lives, noting any records that can't be read in the report.
+func (s *fileStore) walkRecords(report *Report, fn func(location, *cellRecord)) error {
+	sz, err := size(s.data)
+	if err != nil {
+		return err
+	}
+
+	scanner := newRecordScanner(s.data, sz)
+	for {
+		if !scanner.next() {
+			offset, err := scanner.failedAt()
+			if err == nil {
+				return nil
+			}
+			if !errors.Is(err, ErrCorruptRecord) {
+				return err
+			}
+
+			// Only a record with nothing valid after it was torn by an
+			// interrupted write, anything else has a corrupt length.
+			next, ok, err := nextRecord(s.data, offset, sz)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				report.TruncatedAt = offset
+				return nil
+			}
+			report.Unparsable = append(report.Unparsable, RecordError{Offset: offset, Err: err})
+			scanner.seek(next)
+			continue
+		}
+		report.Records++
+
+		offset, rec := scanner.record()
+		r, err := parseRecord(rec, s.codec())
+		if err != nil {
+			report.Unparsable = append(report.Unparsable, RecordError{Offset: offset, Err: err})
+			next, ok, err := nextRecord(s.data, offset, sz)
+			if err != nil {
+				return err
+			}
+			if ok {
+				scanner.seek(next)
+			}
+			continue
+		}
+
+		fn(location{offset: offset, size: int64(len(rec))}, r)
+	}
+}
+
+func (b *Brain) indexedIDs() (map[string]bool, error) {
+	ids, err := b.search.IDs()
+	if err != nil {
+		return nil, err
+	}
+
+	indexed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		indexed[id] = true
+	}
+	return indexed, nil
+}
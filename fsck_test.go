@@ -0,0 +1,104 @@
+package brain
+
+import (
+	"encoding/binary"
+	"os"
+	"path"
+	"testing"
+)
+
+// corruptLength overwrites the length of the record at offset in .data so
+// that it runs past the end of the file.
+func corruptLength(t *testing.T, b *Brain, offset int64) {
+	t.Helper()
+
+	f, err := os.OpenFile(path.Join(b.dir, dataFn), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, 1<<30)
+	if _, err := f.WriteAt(buf, offset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepairKeepsMarkersAfterCorruptRecord(t *testing.T) {
+	b, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	trashed := writeCell(t, b, "trashed")
+	corrupt := writeCell(t, b, "corrupt")
+	if err := b.Delete(trashed); err != nil {
+		t.Fatal(err)
+	}
+	loc, _ := b.fs.table.lookup(corrupt)
+	corruptLength(t, b, loc.offset)
+	before, err := size(b.fs.data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TruncatedAt != 0 {
+		t.Errorf("Verify() found .data torn at %d, want the tombstone after it kept", report.TruncatedAt)
+	}
+	if len(report.Unparsable) != 1 || report.Unparsable[0].Offset != loc.offset {
+		t.Errorf("Verify() found %v unparsable, want the record at %d", report.Unparsable, loc.offset)
+	}
+	if err := b.Repair(report); err != nil {
+		t.Fatal(err)
+	}
+
+	if after, err := size(b.fs.data); err != nil || after != before {
+		t.Errorf(".data is %d bytes after Repair, %v, want %d", after, err, before)
+	}
+	cells, err := b.fs.replay(&Report{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc, ok := cells[trashed]; !ok || rc.cell.trashed == 0 {
+		t.Error("cell was taken out of the trash by Repair")
+	}
+}
+
+func TestRepairCutsOffTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	keep := writeCell(t, b, "keep")
+	torn := writeCell(t, b, "torn")
+	loc, _ := b.fs.table.lookup(torn)
+	if err := os.Truncate(path.Join(dir, dataFn), loc.offset+loc.size-1); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TruncatedAt != loc.offset {
+		t.Errorf("Verify() found .data torn at %d, want %d", report.TruncatedAt, loc.offset)
+	}
+	if err := b.Repair(report); err != nil {
+		t.Fatal(err)
+	}
+	if sz, err := size(b.fs.data); err != nil || sz != loc.offset {
+		t.Errorf(".data is %d bytes after Repair, %v, want %d", sz, err, loc.offset)
+	}
+	if _, err := b.Read(keep); err != nil {
+		t.Errorf("Read(%s): %v", keep, err)
+	}
+}
@@ -0,0 +1,458 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	gitignoreFn = ".gitignore"
+
+	// conflictsFn is where the conflicts found by Pull are kept until they
+	// are resolved. It lives in .git so that it is never committed.
+	conflictsFn = "brain-conflicts.json"
+
+	// The remote Push and Pull use when none is given.
+	defaultRemote = "origin"
+)
+
+// What a Markdown brain's repository ignores, which is everything brain
+// keeps for itself.
+const gitignore = `.lock
+.index.bleve/
+`
+
+// The identity commits are made with when git hasn't been told who the
+// user is.
+var gitIdentity = []string{
+	"GIT_AUTHOR_NAME=brain",
+	"GIT_AUTHOR_EMAIL=brain@localhost",
+	"GIT_COMMITTER_NAME=brain",
+	"GIT_COMMITTER_EMAIL=brain@localhost",
+}
+
+// WithGit keeps a brain opened with OpenMarkdown in a git repository,
+// creating one in its folder if there isn't one already. Every change to
+// the brain is committed, as are files changed by other tools when the
+// brain is opened, and the brain can be synced with other copies of it
+// with Push and Pull.
+//
+// Brains that keep their cells in .data can't be kept in git, Open fails
+// with ErrNotSupported if it is given WithGit.
+func WithGit() Option {
+	return func(b *Brain) {
+		b.git = true
+	}
+}
+
+// A Conflict is a cell that was changed both here and in the remote brain
+// since they were last synced. Pull keeps the local revision in the brain
+// and the remote one in the conflict until it is resolved with
+// ResolveConflict.
+type Conflict struct {
+	// ID is the identifier of the local revision of the cell.
+	ID string `json:"id"`
+
+	// Path is the cell's file, relative to the brain's folder.
+	Path string `json:"path"`
+
+	// Theirs is the data of the remote revision of the cell.
+	Theirs string `json:"theirs"`
+}
+
+// Push sends the brain's commits to the given git remote, which may be the
+// name of a remote of the brain's repository or the URL or path of any
+// other repository, such as a bare one on a USB stick. It pushes to the
+// remote named origin if none is given.
+func (b *Brain) Push(remote string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, err := b.gitStore()
+	if err != nil {
+		return err
+	}
+	if remote == "" {
+		remote = defaultRemote
+	}
+
+	branch, err := s.git.branch()
+	if err != nil {
+		return err
+	}
+	_, err = s.git.run("push", remote, "HEAD:refs/heads/"+branch)
+	return err
+}
+
+// Pull merges the commits of the given git remote into the brain, see
+// Push, and brings its index up to date with the cells that were pulled.
+//
+// Cells that were changed on both sides keep their local revision, and
+// the remote revision is returned as a Conflict. The conflicts are kept
+// until they are resolved, see Conflicts.
+func (b *Brain) Pull(remote string) ([]Conflict, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, err := b.gitStore()
+	if err != nil {
+		return nil, err
+	}
+	if remote == "" {
+		remote = defaultRemote
+	}
+
+	branch, err := s.git.branch()
+	if err != nil {
+		return nil, err
+	}
+	heads, err := s.git.run("ls-remote", "--heads", remote, "refs/heads/"+branch)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(heads) == "" {
+		// The remote is empty, there is nothing to pull.
+		return nil, nil
+	}
+
+	orig, err := s.git.run("rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.git.run("fetch", remote, branch); err != nil {
+		return nil, err
+	}
+
+	conflicts, err := s.git.merge("FETCH_HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	// Files git wrote are newer than their front matter says, which would
+	// otherwise pass for being edited by another tool.
+	changed, err := s.git.run("diff", "--name-only", "-z", strings.TrimSpace(orig), "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.resetTimes(splitNul(changed)); err != nil {
+		return nil, err
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	if _, err := b.reindex(); err != nil {
+		return nil, err
+	}
+
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+	all, err := s.git.conflicts()
+	if err != nil {
+		return nil, err
+	}
+	return conflicts, s.git.saveConflicts(mergeConflicts(all, conflicts))
+}
+
+// Conflicts returns the conflicts left by Pull that haven't been resolved
+// yet.
+func (b *Brain) Conflicts() ([]Conflict, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	s, err := b.gitStore()
+	if err != nil {
+		return nil, err
+	}
+	return s.git.conflicts()
+}
+
+// ResolveConflict resolves the conflict for the cell with the given
+// identifier by keeping the local revision, or by replacing it with the
+// remote one if theirs is set.
+func (b *Brain) ResolveConflict(id string, theirs bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, err := b.gitStore()
+	if err != nil {
+		return err
+	}
+	conflicts, err := s.git.conflicts()
+	if err != nil {
+		return err
+	}
+
+	var left []Conflict
+	for _, c := range conflicts {
+		if c.ID != id {
+			left = append(left, c)
+			continue
+		}
+		if !theirs {
+			continue
+		}
+		// The cell may have been edited since it was pulled, in which case
+		// it's the latest revision that is replaced.
+		cell, err := b.latest(id)
+		if err != nil {
+			return err
+		}
+		if err := b.edit(cell.id, c.Theirs); err != nil {
+			return err
+		}
+	}
+	return s.git.saveConflicts(left)
+}
+
+// gitStore returns the store of a brain kept in git, or an error if it
+// isn't kept in git.
+func (b *Brain) gitStore() (*MarkdownStore, error) {
+	if b.readOnly {
+		return nil, ErrReadOnly
+	}
+	s, ok := b.store.(*MarkdownStore)
+	if !ok || s.git == nil {
+		return nil, fmt.Errorf("%w: the brain isn't kept in git", ErrNotSupported)
+	}
+	return s, nil
+}
+
+// A gitRepo is the git repository in a Markdown brain's folder.
+type gitRepo struct {
+	dir string
+
+	// identity is added to the environment of git commands if git hasn't
+	// been configured with the user's.
+	identity []string
+}
+
+// openGitRepo opens the git repository in the given folder, creating it if
+// needed, and commits anything that has changed since brain last did.
+func openGitRepo(dir string) (*gitRepo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, err
+	}
+	r := &gitRepo{dir: dir}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := r.run("init", "--quiet"); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := r.run("config", "user.email"); err != nil {
+		r.identity = gitIdentity
+	}
+
+	fn := filepath.Join(dir, gitignoreFn)
+	if _, err := os.Stat(fn); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(fn, []byte(gitignore), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.commit("Sync changes made outside brain"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// run runs git in the repository, returning what it printed.
+func (r *gitRepo) run(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	if r.identity != nil {
+		cmd.Env = append(os.Environ(), r.identity...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return stdout.String(), &gitError{cmd: args[0], msg: msg, err: err}
+	}
+	return stdout.String(), nil
+}
+
+// A gitError is returned when a git command fails, with what it printed
+// to stderr.
+type gitError struct {
+	cmd, msg string
+	err      error
+}
+
+func (e *gitError) Error() string {
+	return fmt.Sprintf("git %s: %s", e.cmd, e.msg)
+}
+
+func (e *gitError) Unwrap() error {
+	return e.err
+}
+
+// commit commits every change in the repository, if there are any.
+func (r *gitRepo) commit(msg string) error {
+	if _, err := r.run("add", "--all"); err != nil {
+		return err
+	}
+	status, err := r.run("status", "--porcelain")
+	if err != nil || strings.TrimSpace(status) == "" {
+		return err
+	}
+	_, err = r.run("commit", "--quiet", "-m", msg)
+	return err
+}
+
+// branch returns the name of the branch that is checked out.
+func (r *gitRepo) branch() (string, error) {
+	branch, err := r.run("symbolic-ref", "--short", "HEAD")
+	return strings.TrimSpace(branch), err
+}
+
+// merge merges the given commit, resolving conflicting files in favour of
+// ours and returning the cells that conflicted.
+func (r *gitRepo) merge(commit string) ([]Conflict, error) {
+	_, err := r.run("merge", "--quiet", "--no-edit", "--allow-unrelated-histories", commit)
+
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) {
+		return nil, err
+	}
+
+	unmerged, uerr := r.run("diff", "--name-only", "-z", "--diff-filter=U")
+	if uerr != nil {
+		return nil, uerr
+	}
+	paths := splitNul(unmerged)
+	if len(paths) == 0 {
+		// The merge failed for some other reason.
+		return nil, err
+	}
+
+	var conflicts []Conflict
+	for _, p := range paths {
+		c, err := r.resolve(p)
+		if err != nil {
+			r.run("merge", "--abort")
+			return nil, err
+		}
+		if c != nil {
+			conflicts = append(conflicts, *c)
+		}
+	}
+
+	if _, err := r.run("commit", "--quiet", "--no-edit"); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// resolve resolves a conflicting file by keeping our side, or their side
+// if we deleted it. If the file is a cell that was changed on both sides
+// it returns their revision as a Conflict.
+func (r *gitRepo) resolve(p string) (*Conflict, error) {
+	ours, oerr := r.run("show", ":2:"+p)
+	theirs, terr := r.run("show", ":3:"+p)
+
+	switch {
+	case oerr == nil:
+		if _, err := r.run("checkout", "--ours", "--", p); err != nil {
+			return nil, err
+		}
+	case terr == nil:
+		if _, err := r.run("checkout", "--theirs", "--", p); err != nil {
+			return nil, err
+		}
+	default:
+		if _, err := r.run("rm", "--quiet", "--cached", "--", p); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if _, err := r.run("add", "--", p); err != nil {
+		return nil, err
+	}
+
+	if oerr != nil || terr != nil || filepath.Ext(p) != mdExt {
+		return nil, nil
+	}
+	on, err := parseNote(p, []byte(ours))
+	if err != nil || on.fm.ID == "" {
+		return nil, nil
+	}
+	tn, err := parseNote(p, []byte(theirs))
+	if err != nil || tn.body == on.body {
+		return nil, nil
+	}
+	return &Conflict{ID: on.fm.ID, Path: p, Theirs: tn.body}, nil
+}
+
+// conflicts returns the conflicts that haven't been resolved yet.
+func (r *gitRepo) conflicts() ([]Conflict, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(r.dir, ".git", conflictsFn))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []Conflict
+	if err := json.Unmarshal(buf, &conflicts); err != nil {
+		return nil, fmt.Errorf("invalid conflicts file: %w", err)
+	}
+	return conflicts, nil
+}
+
+func (r *gitRepo) saveConflicts(conflicts []Conflict) error {
+	fn := filepath.Join(r.dir, ".git", conflictsFn)
+	if len(conflicts) == 0 {
+		err := os.Remove(fn)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	buf, err := json.MarshalIndent(conflicts, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, buf, 0644)
+}
+
+// mergeConflicts adds new conflicts to those that were already known,
+// replacing any for the same cell.
+func mergeConflicts(known, found []Conflict) []Conflict {
+	ids := make(map[string]bool, len(found))
+	for _, c := range found {
+		ids[c.ID] = true
+	}
+
+	var conflicts []Conflict
+	for _, c := range known {
+		if !ids[c.ID] {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return append(conflicts, found...)
+}
+
+// splitNul splits the NUL separated output of a git command.
+func splitNul(s string) []string {
+	var parts []string
+	for _, p := range strings.Split(s, "\x00") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,79 @@
+package brain
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// openGitBrain opens a Markdown brain kept in git in a new folder, skipping
+// the test if git isn't installed.
+func openGitBrain(t *testing.T) *Brain {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	b, err := OpenMarkdown(t.TempDir(), WithGit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPullConflict(t *testing.T) {
+	remote := t.TempDir()
+	ours, theirs := openGitBrain(t), openGitBrain(t)
+	defer ours.Close()
+	defer theirs.Close()
+	if out, err := exec.Command("git", "init", "--quiet", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+
+	id := writeCell(t, theirs, "shared")
+	if err := theirs.Push(remote); err != nil {
+		t.Fatal(err)
+	}
+	if conflicts, err := ours.Pull(remote); err != nil || len(conflicts) > 0 {
+		t.Fatalf("first pull: %v, %v", conflicts, err)
+	}
+	if c, err := ours.Read(id); err != nil || c.Data() != "shared" {
+		t.Fatalf("pulled cell: %v, %v", c, err)
+	}
+
+	ourEdit := editCell(t, ours, id, "our edit")
+	editCell(t, theirs, id, "their edit")
+	if err := theirs.Push(remote); err != nil {
+		t.Fatal(err)
+	}
+	conflicts, err := ours.Pull(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].ID != ourEdit || conflicts[0].Theirs != "their edit" {
+		t.Fatalf("conflicts = %+v, want their edit of %s", conflicts, ourEdit)
+	}
+	if c, err := ours.Read(ourEdit); err != nil || c.Data() != "our edit" {
+		t.Errorf("pull didn't keep our edit: %v, %v", c, err)
+	}
+
+	// Resolving replaces whatever the latest revision is by then.
+	editCell(t, ours, ourEdit, "our second edit")
+	if err := ours.ResolveConflict(ourEdit, true); err != nil {
+		t.Fatal(err)
+	}
+	if left, err := ours.Conflicts(); err != nil || len(left) > 0 {
+		t.Errorf("conflicts left after resolving: %v, %v", left, err)
+	}
+	ids, err := ours.indexedIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 {
+		t.Fatalf("%d live revisions after resolving, want 1", len(ids))
+	}
+	for live := range ids {
+		if c, err := ours.Read(live); err != nil || c.Data() != "their edit" {
+			t.Errorf("resolved cell: %v, %v", c, err)
+		}
+	}
+}
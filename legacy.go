@@ -0,0 +1,60 @@
+package brain
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// stableMarker prefixes legacy records that carry a stable identifier.
+// Records written before stable identifiers existed always start with a
+// digit so the two can't be confused.
+const stableMarker = '@'
+
+// parseLegacyCell parses a cell written before .data was framed. These
+// records are "<ts> <data>", or "@<id> <ts> <data>" for cells with a
+// stable identifier, with nothing to mark where they end.
+func parseLegacyCell(offset int64, data string) (*Cell, error) {
+	var id string
+	if len(data) > 0 && data[0] == stableMarker {
+		sp := strings.IndexByte(data, ' ')
+		if sp < 0 {
+			return nil, errors.New("data does not include identifier")
+		}
+		id, data = data[1:sp], data[sp+1:]
+	}
+
+	if len(data) < 11 {
+		return nil, errors.New("data does not include timestamp")
+	}
+	ts, _ := strconv.ParseInt(data[:10], 10, 64)
+
+	return &Cell{
+		id:     id,
+		offset: offset,
+		data:   data[11:],
+		ts:     ts,
+	}, nil
+}
+
+// isLegacyIdentifier reports whether id is an offset:size identifier.
+func isLegacyIdentifier(id string) bool {
+	return strings.Contains(id, ":")
+}
+
+func parseIdentifier(id string) (int64, int64, error) {
+	ids := strings.Split(id, ":")
+	if len(ids) != 2 {
+		return 0, 0, errors.New("invalid cell identifier")
+	}
+
+	offset, err := strconv.ParseInt(ids[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := strconv.ParseInt(ids[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return offset, size, nil
+}
@@ -0,0 +1,263 @@
+package brain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sno6/brain/search"
+)
+
+// wikiLink matches a [[link]] to another cell, which can't span lines.
+var wikiLink = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+
+// A Link is a [[link]] from one cell to another.
+type Link struct {
+	// Target is what's between the brackets, which is either the title
+	// of a cell, its first line, or its identifier.
+	Target string
+
+	// ID is the identifier of the live cell the link resolves to, or
+	// empty if there isn't one.
+	ID string
+}
+
+// ParseLinks returns the targets of the [[links]] in s, in the order they
+// first appear.
+func ParseLinks(s string) []string {
+	var targets []string
+	seen := make(map[string]bool)
+	for _, m := range wikiLink.FindAllStringSubmatch(s, -1) {
+		t := strings.TrimSpace(m[1])
+		k := linkKey(t)
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// linkKey returns how a link target or a cell's name is indexed, so that
+// they match whatever their case and spacing.
+func linkKey(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// linkKeys returns the targets of the cell's links as they are indexed.
+func (c *Cell) linkKeys() []string {
+	targets := ParseLinks(c.data)
+	keys := make([]string, len(targets))
+	for i, t := range targets {
+		keys[i] = linkKey(t)
+	}
+	return keys
+}
+
+// names returns what the cell can be linked to by besides its identifier:
+// its title, and its first line without any Markdown heading marks.
+func (c *Cell) names() []string {
+	var names []string
+	if t := linkKey(c.meta["title"]); t != "" {
+		names = append(names, t)
+	}
+	for _, line := range strings.Split(c.data, "\n") {
+		line = linkKey(strings.TrimLeft(strings.TrimSpace(line), "# "))
+		if line == "" {
+			continue
+		}
+		if len(names) == 0 || names[0] != line {
+			names = append(names, line)
+		}
+		break
+	}
+	return names
+}
+
+// Links returns the [[links]] in the cell with the given identifier, each
+// resolved to the cell it refers to as ResolveLink does.
+func (b *Brain) Links(id string) ([]Link, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	cell, err := b.read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := ParseLinks(cell.data)
+	links := make([]Link, len(targets))
+	for i, t := range targets {
+		links[i].Target = t
+
+		target, err := b.resolveLink(t)
+		if errors.Is(err, ErrUnknownCell) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		links[i].ID = target.id
+	}
+	return links, nil
+}
+
+// Backlinks returns the live cells that link to the cell with the given
+// identifier, by its name or by the identifier of any of its revisions,
+// newest first.
+func (b *Brain) Backlinks(id string) ([]*Cell, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	revisions, err := b.history(id)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := revisions[0].names()
+	for _, r := range revisions {
+		keys = append(keys, linkKey(r.id))
+	}
+	ids, err := b.search.WithTerms(search.LinkField, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var cells []*Cell
+	for _, linking := range ids {
+		if linking == revisions[0].id {
+			continue
+		}
+		cell, err := b.read(linking)
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell)
+	}
+	sort.SliceStable(cells, func(i, j int) bool {
+		return cells[i].ts > cells[j].ts
+	})
+	return cells, nil
+}
+
+// ResolveLink returns the live cell that a [[link]] to target refers to.
+//
+// A target that is the identifier of a cell refers to the latest revision
+// of that cell, so that links keep working when the cell is edited. Any
+// other target refers to the newest cell with it as its title or first
+// line, ignoring case and spacing. It returns an error wrapping
+// ErrUnknownCell if there's no such cell.
+func (b *Brain) ResolveLink(target string) (*Cell, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.resolveLink(target)
+}
+
+func (b *Brain) resolveLink(target string) (*Cell, error) {
+	for _, id := range []string{target, strings.ToUpper(target)} {
+		cell, err := b.latest(id)
+		if err == nil {
+			return cell, nil
+		}
+		if !errors.Is(err, ErrUnknownCell) {
+			return nil, err
+		}
+	}
+
+	ids, err := b.search.WithTerms(search.NameField, []string{linkKey(target)})
+	if err != nil {
+		return nil, err
+	}
+	var newest *Cell
+	for _, id := range ids {
+		cell, err := b.read(id)
+		if err != nil {
+			return nil, err
+		}
+		if newest == nil || cell.ts > newest.ts {
+			newest = cell
+		}
+	}
+	if newest == nil {
+		return nil, fmt.Errorf("%w: nothing is called %q", ErrUnknownCell, target)
+	}
+	return newest, nil
+}
+
+// latest returns the live revision of the cell with the given identifier,
+// which is the cell itself unless it has since been edited.
+func (b *Brain) latest(id string) (*Cell, error) {
+	cell, err := b.read(id)
+	if err != nil {
+		return nil, err
+	}
+	if live, err := b.search.Contains(cell.id); err != nil || live {
+		return cell, err
+	}
+	if cell.trashed != 0 {
+		return nil, fmt.Errorf("%w: %s is in the trash", ErrUnknownCell, id)
+	}
+
+	if id, err = b.newestRevision(cell.id); err != nil {
+		return nil, err
+	}
+
+	if live, err := b.search.Contains(id); err != nil || !live {
+		if err == nil {
+			err = fmt.Errorf("%w: %s is no longer live", ErrUnknownCell, cell.id)
+		}
+		return nil, err
+	}
+	return b.read(id)
+}
+
+// newestRevision follows the revisions of the cell with the given
+// identifier to the newest one.
+//
+// Stores only know which revision a cell supersedes, so the way forward is
+// found by going through every cell the first time it's needed. It is then
+// kept up to date as cells are edited, until the cells are changed by
+// other means and it's found again.
+func (b *Brain) newestRevision(id string) (string, error) {
+	b.successorsMu.Lock()
+	defer b.successorsMu.Unlock()
+
+	if b.successors == nil {
+		next := make(map[string]string)
+		err := b.store.Iterate(func(c *Cell) error {
+			if c.supersedes != "" {
+				next[c.supersedes] = c.id
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		b.successors = next
+	}
+
+	for b.successors[id] != "" {
+		id = b.successors[id]
+	}
+	return id, nil
+}
+
+// addSuccessor records that a cell was replaced by a new revision.
+func (b *Brain) addSuccessor(prev, id string) {
+	b.successorsMu.Lock()
+	defer b.successorsMu.Unlock()
+	if b.successors != nil {
+		b.successors[prev] = id
+	}
+}
+
+// forgetSuccessors has the revisions gone through again the next time
+// they are needed, after cells were changed other than by editing them.
+func (b *Brain) forgetSuccessors() {
+	b.successorsMu.Lock()
+	defer b.successorsMu.Unlock()
+	b.successors = nil
+}
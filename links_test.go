@@ -0,0 +1,37 @@
+package brain
+
+import "testing"
+
+func TestResolveLinkToEditedCell(t *testing.T) {
+	b, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	first := writeCell(t, b, "first")
+	second := editCell(t, b, first, "second")
+	if c, err := b.ResolveLink(first); err != nil || c.Identifier() != second {
+		t.Fatalf("ResolveLink(%s) = %v, want the second revision", first, err)
+	}
+	// The revisions were gone through already, so this one is only known
+	// of from the edit.
+	third := editCell(t, b, second, "third")
+
+	for _, id := range []string{first, second, third} {
+		c, err := b.ResolveLink(id)
+		if err != nil {
+			t.Fatalf("ResolveLink(%s): %v", id, err)
+		}
+		if c.Identifier() != third {
+			t.Errorf("ResolveLink(%s) = %q, want the latest revision %q", id, c.Data(), "third")
+		}
+	}
+
+	if err := b.Delete(third); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ResolveLink(first); err == nil {
+		t.Error("ResolveLink() found a cell that is in the trash")
+	}
+}
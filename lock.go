@@ -0,0 +1,94 @@
+package brain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const lockFn = ".lock"
+
+// ErrReadOnly is returned when changing a brain that was opened with
+// ReadOnly.
+var ErrReadOnly = errors.New("brain is open read-only")
+
+// errLocked is returned by lockFile when another process holds the lock.
+var errLocked = errors.New("lock is held by another process")
+
+// A LockedError is returned by Open when another process already has the
+// brain open. The brain can still be opened with ReadOnly.
+type LockedError struct {
+	// PID is the process that has the brain open, or 0 if it isn't known.
+	PID int
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return "brain is in use by another process"
+	}
+	return fmt.Sprintf("brain is in use by PID %d", e.PID)
+}
+
+// A dirLock is an advisory lock on a brain directory. Only the process
+// holding it may write to the brain, which is what keeps the offsets of
+// appended records from overlapping.
+//
+// The lock file holds the PID of that process so that others can say who
+// has the brain open. The lock itself is released by the OS if the
+// process dies, so a stale PID is never mistaken for a holder.
+type dirLock struct {
+	f *os.File
+}
+
+// acquireLock takes the lock on the brain in the given directory, or
+// returns a *LockedError if another process has it.
+func acquireLock(dir string) (*dirLock, error) {
+	f, err := os.OpenFile(path.Join(dir, lockFn), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(f); err != nil {
+		defer f.Close()
+		if errors.Is(err, errLocked) {
+			return nil, &LockedError{PID: lockHolder(f)}
+		}
+		return nil, err
+	}
+
+	pid := strconv.Itoa(os.Getpid()) + "\n"
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt([]byte(pid), 0)
+	}
+	if err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, err
+	}
+	return &dirLock{f: f}, nil
+}
+
+// release gives up the lock.
+func (l *dirLock) release() error {
+	l.f.Truncate(0)
+	if err := unlockFile(l.f); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// lockHolder returns the PID written to a lock file, or 0 if there is
+// none.
+func lockHolder(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
@@ -0,0 +1,47 @@
+package brain
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestOpenLockedBrain(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	before := writeCell(t, b, "before")
+
+	var locked *LockedError
+	if _, err := Open(dir); !errors.As(err, &locked) {
+		t.Fatalf("second Open = %v, want a *LockedError", err)
+	}
+	if locked.PID != os.Getpid() {
+		t.Errorf("lock held by PID %d, want %d", locked.PID, os.Getpid())
+	}
+
+	ro, err := Open(dir, ReadOnly())
+	if err != nil {
+		t.Fatalf("opening read-only: %v", err)
+	}
+	defer ro.Close()
+
+	after := writeCell(t, b, "after")
+
+	if c, err := ro.Read(before); err != nil || c.Data() != "before" {
+		t.Errorf("read-only brain reads %q = %v, %v", before, c, err)
+	}
+	ids, err := ro.indexedIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids[after] {
+		t.Errorf("read-only brain sees %q, written after it was opened", after)
+	}
+	if err := ro.Write("refused"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("writing to a read-only brain = %v, want ErrReadOnly", err)
+	}
+}
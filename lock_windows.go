@@ -0,0 +1,29 @@
+//go:build windows
+// +build windows
+
+package brain
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows locks are mandatory for the locked range, so we lock a byte far
+// past the end of the file to leave the PID in it readable.
+const lockOffsetHigh = 1
+
+func lockFile(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK | windows.LOCKFILE_FAIL_IMMEDIATELY)
+	err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, 1, 0, ol)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return errLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, ol)
+}
@@ -0,0 +1,691 @@
+package brain
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sno6/brain/search"
+)
+
+const (
+	// Folders within a Markdown brain for cells that aren't live. They
+	// are hidden so that editors such as Obsidian leave them alone.
+	mdTrashDir   = ".trash"
+	mdHistoryDir = ".history"
+
+	mdExt = ".md"
+
+	// How many characters of a cell's first line to name its file after.
+	mdNameLength = 50
+)
+
+var mdFence = []byte("---\n")
+
+// A MarkdownStore is a Store that keeps each cell as a Markdown file in a
+// folder, such as an Obsidian vault, so that it can be read and edited
+// with other tools. Each file starts with YAML front matter holding the
+// cell's identifier, when it was created and last updated, and its tags:
+//
+//	---
+//	id: 01GBQ4H9C8ZJ4E4ZB7N6E4T6XW
+//	created: 2022-08-30T09:12:44Z
+//	updated: 2022-09-02T17:03:10Z
+//	tags: [golang]
+//	---
+//	The cell's data.
+//
+// Files may be kept in subfolders. Any other front matter with a single
+// value is the cell's metadata, and the rest is kept as it is. Earlier
+// revisions of edited cells are kept in .history, and cells in the trash
+// are moved to .trash.
+//
+// Files that are added or changed by other tools are picked up when the
+// store is opened, see OpenMarkdown.
+type MarkdownStore struct {
+	dir   string
+	notes map[string]*mdNote
+
+	// changed are the identifiers of notes that were added or edited
+	// outside of brain, and dirty the notes whose front matter needs
+	// to be written to bring them up to date.
+	changed []string
+	dirty   []*mdNote
+
+	// git is the repository the folder is kept in, if it was opened
+	// WithGit, which every change is committed to.
+	git *gitRepo
+}
+
+// An mdNote is a cell's Markdown file.
+type mdNote struct {
+	// path is the file's path relative to the store's folder.
+	path string
+	fm   frontMatter
+	body string
+}
+
+type frontMatter struct {
+	ID         string    `yaml:"id"`
+	Created    time.Time `yaml:"created"`
+	Updated    time.Time `yaml:"updated"`
+	Tags       []string  `yaml:"tags,omitempty,flow"`
+	Supersedes string    `yaml:"supersedes,omitempty"`
+
+	// When the note was moved to the trash, and where from.
+	Trashed time.Time `yaml:"trashed,omitempty"`
+	Origin  string    `yaml:"origin,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// NewMarkdownStore opens the Markdown files in the given folder, creating
+// it if it doesn't exist yet.
+func NewMarkdownStore(dir string) (*MarkdownStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	s := &MarkdownStore{dir: dir, notes: make(map[string]*mdNote)}
+	if err := s.scan(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenMarkdown initialises a Brain that keeps its cells as Markdown files
+// in the given folder, see MarkdownStore. The index is kept in the folder
+// too, and is brought up to date with any files that were added, changed
+// or removed by other tools since the brain was last opened.
+//
+// Like Open, OpenMarkdown returns a *LockedError if another process has
+// the brain open, unless the ReadOnly option is given. Markdown brains
+// can't be encrypted, so WithPassphrase makes it fail with an error
+// wrapping ErrNotSupported. Other options that configure the .data file
+// have no effect, see WithGit to keep the folder in git.
+func OpenMarkdown(dir string, opts ...Option) (*Brain, error) {
+	b := &Brain{
+		dir:       dir,
+		retention: DefaultTrashRetention,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.passphrase != "" {
+		return nil, fmt.Errorf("%w: Markdown brains can't be encrypted", ErrNotSupported)
+	}
+
+	s, err := NewMarkdownStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	b.store = s
+
+	if b.readOnly {
+		// Leave the files and index to the process that has the brain
+		// open, and build an index of our own in memory.
+		if b.search, err = search.NewMemOnly(); err != nil {
+			return nil, err
+		}
+		if _, err := b.reindex(); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	lock, err := acquireLock(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.openMarkdown(s); err != nil {
+		lock.release()
+		return nil, err
+	}
+	b.lock = lock
+	b.startBackups()
+	return b, nil
+}
+
+// openMarkdown opens the index of a Markdown brain we hold the lock for
+// and syncs it with the files.
+func (b *Brain) openMarkdown(s *MarkdownStore) error {
+	var err error
+	if b.search, err = search.New(b.dir); err != nil {
+		return err
+	}
+	if err := b.upgradeIndex(); err != nil {
+		return err
+	}
+	if err := b.syncIndex(s.changed); err != nil {
+		return err
+	}
+
+	// The front matter of changed files is only brought up to date once
+	// they are indexed, so that they are found again if we're interrupted.
+	if err := s.flush(); err != nil {
+		return err
+	}
+	if _, err := b.purgeExpired(); err != nil {
+		return err
+	}
+
+	if b.git {
+		s.git, err = openGitRepo(b.dir)
+	}
+	return err
+}
+
+// syncIndex indexes live cells that are missing from the index along with
+// the given cells that have changed, and removes everything else from it.
+func (b *Brain) syncIndex(changed []string) error {
+	b.forgetSuccessors()
+	cells, err := b.storedCells()
+	if err != nil {
+		return err
+	}
+	ids, err := b.search.IDs()
+	if err != nil {
+		return err
+	}
+	indexed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		indexed[id] = true
+	}
+
+	batch := b.search.NewBatch()
+	for id, rc := range cells {
+		if rc.indexed() && !indexed[id] {
+			if err := batch.Index(id, b.document(rc.cell)); err != nil {
+				return err
+			}
+		}
+	}
+	for id := range indexed {
+		if rc, ok := cells[id]; !ok || !rc.indexed() {
+			batch.Delete(id)
+		}
+	}
+	for _, id := range changed {
+		if rc, ok := cells[id]; ok && rc.indexed() {
+			if err := batch.Index(id, b.document(rc.cell)); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.Commit()
+}
+
+// Append writes a new cell to a file named after its first line. A new
+// revision of a live cell replaces the cell's file instead, and the
+// earlier revision is moved to .history.
+func (s *MarkdownStore) Append(c *Cell) error {
+	ts := time.Unix(c.ts, 0).UTC()
+	n := &mdNote{
+		fm: frontMatter{
+			ID:         c.id,
+			Created:    ts,
+			Updated:    ts,
+			Tags:       ParseTags(c.data),
+			Supersedes: c.supersedes,
+			Extra:      metadataFields(nil, c.meta),
+		},
+		body: c.data,
+	}
+
+	msg := "Write "
+	prev, ok := s.notes[c.supersedes]
+	if ok && prev.live() {
+		msg = "Edit "
+		n.path = prev.path
+		n.fm.Created = prev.fm.Created
+		n.fm.Tags = mergeTags(prev.explicitTags(), n.fm.Tags)
+		n.fm.Extra = metadataFields(prev.fm.Extra, c.meta)
+
+		if err := s.move(prev, filepath.Join(mdHistoryDir, prev.fm.ID+mdExt)); err != nil {
+			return err
+		}
+	} else {
+		n.path = s.freePath("", noteName(c))
+	}
+
+	if err := s.write(n); err != nil {
+		return err
+	}
+	s.notes[c.id] = n
+	return s.commit(msg + n.path)
+}
+
+// Read returns the cell with the given identifier.
+func (s *MarkdownStore) Read(id string) (*Cell, error) {
+	n, ok := s.notes[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCell, id)
+	}
+	return n.cell(), nil
+}
+
+// Iterate calls fn with every cell, oldest first.
+func (s *MarkdownStore) Iterate(fn func(*Cell) error) error {
+	cells := make([]*Cell, 0, len(s.notes))
+	for _, n := range s.notes {
+		cells = append(cells, n.cell())
+	}
+
+	// Identifiers are time-ordered, so they break ties between revisions
+	// made within the same second.
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].ts != cells[j].ts {
+			return cells[i].ts < cells[j].ts
+		}
+		return cells[i].id < cells[j].id
+	})
+
+	for _, c := range cells {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a cell's file, along with the files of its earlier
+// revisions in .history.
+func (s *MarkdownStore) Delete(id string) error {
+	n, ok := s.notes[id]
+	if !ok {
+		return nil
+	}
+	for prev := n; prev != nil; {
+		if err := os.Remove(filepath.Join(s.dir, prev.path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(s.notes, prev.fm.ID)
+
+		prev, ok = s.notes[prev.fm.Supersedes]
+		if !ok || !strings.HasPrefix(prev.path, mdHistoryDir+string(filepath.Separator)) {
+			break
+		}
+	}
+	return s.commit("Purge " + n.path)
+}
+
+// SetTrashed moves a cell's file to .trash, or back to where it was.
+func (s *MarkdownStore) SetTrashed(id string, ts int64) error {
+	n, ok := s.notes[id]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCell, id)
+	}
+
+	if ts == 0 {
+		origin := n.fm.Origin
+		if origin == "" {
+			origin = filepath.Base(n.path)
+		}
+		n.fm.Trashed, n.fm.Origin = time.Time{}, ""
+		if err := s.move(n, s.freePath(filepath.Dir(origin), filepath.Base(origin))); err != nil {
+			return err
+		}
+		return s.commit("Restore " + n.path)
+	}
+
+	path := n.path
+	n.fm.Trashed = time.Unix(ts, 0).UTC()
+	n.fm.Origin = n.path
+	if err := s.move(n, s.freePath(mdTrashDir, filepath.Base(n.path))); err != nil {
+		return err
+	}
+	return s.commit("Delete " + path)
+}
+
+// Trashed returns when each cell in the trash was moved there.
+func (s *MarkdownStore) Trashed() (map[string]int64, error) {
+	trash := make(map[string]int64)
+	for id, n := range s.notes {
+		if !n.fm.Trashed.IsZero() {
+			trash[id] = n.fm.Trashed.Unix()
+		}
+	}
+	return trash, nil
+}
+
+// Close does nothing, as every change is written as it is made.
+func (s *MarkdownStore) Close() error {
+	return nil
+}
+
+// scan reads every Markdown file in the store's folder. Files without an
+// identifier are given one, as are files with the same identifier as one
+// read before them, such as copies made in an editor. Files whose
+// modification time is later than the time in their front matter were
+// edited by another tool, so their front matter is brought up to date.
+// Either way the new front matter is only written by flush.
+func (s *MarkdownStore) scan() error {
+	return filepath.Walk(s.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+
+		name := info.Name()
+		if info.IsDir() {
+			// Skip hidden folders, such as .git and the index, other than
+			// our own.
+			if strings.HasPrefix(name, ".") && rel != "." && rel != mdTrashDir && rel != mdHistoryDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(name) != mdExt || strings.HasPrefix(name, ".") {
+			return nil
+		}
+
+		buf, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		n, err := parseNote(rel, buf)
+		if err != nil {
+			// Leave files we can't make sense of alone rather than risk
+			// overwriting them.
+			return nil
+		}
+
+		if _, ok := s.notes[n.fm.ID]; ok {
+			// The copy becomes a cell of its own, with no history.
+			n.fm.ID, n.fm.Supersedes = "", ""
+		}
+
+		modified := info.ModTime().UTC().Truncate(time.Second)
+		switch {
+		case n.fm.ID == "":
+			n.fm.ID = newID()
+			n.fm.Created, n.fm.Updated = modified, modified
+		case modified.After(n.fm.Updated):
+			n.fm.Updated = modified
+		default:
+			s.notes[n.fm.ID] = n
+			return nil
+		}
+
+		s.notes[n.fm.ID] = n
+		s.changed = append(s.changed, n.fm.ID)
+		s.dirty = append(s.dirty, n)
+		return nil
+	})
+}
+
+// reload forgets every note and scans the folder again, writing the front
+// matter of any notes that need it straight away.
+func (s *MarkdownStore) reload() error {
+	s.notes = make(map[string]*mdNote)
+	if err := s.scan(); err != nil {
+		return err
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.commit("Sync changes made outside brain")
+}
+
+// resetTimes sets the modification time of the given files, which were
+// written by git, back to when their notes were last updated.
+func (s *MarkdownStore) resetTimes(paths []string) error {
+	for _, p := range paths {
+		if filepath.Ext(p) != mdExt {
+			continue
+		}
+		fn := filepath.Join(s.dir, p)
+		buf, err := ioutil.ReadFile(fn)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		n, err := parseNote(p, buf)
+		if err != nil || n.fm.ID == "" {
+			continue
+		}
+		if err := os.Chtimes(fn, n.fm.Updated, n.fm.Updated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit commits the store's folder to git, if it is kept in git.
+func (s *MarkdownStore) commit(msg string) error {
+	if s.git == nil {
+		return nil
+	}
+	return s.git.commit(msg)
+}
+
+// flush writes the front matter of notes that were changed by scan.
+func (s *MarkdownStore) flush() error {
+	for _, n := range s.dirty {
+		if err := s.write(n); err != nil {
+			return err
+		}
+	}
+	s.changed, s.dirty = nil, nil
+	return nil
+}
+
+// write writes a note to its file, setting the file's modification time
+// to the time the note was updated so that we can tell when it has been
+// edited by another tool.
+func (s *MarkdownStore) write(n *mdNote) error {
+	fm, err := yaml.Marshal(n.fm)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(mdFence)
+	buf.Write(fm)
+	buf.Write(mdFence)
+	buf.WriteString(n.body)
+
+	p := filepath.Join(s.dir, n.path)
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Chtimes(p, n.fm.Updated, n.fm.Updated)
+}
+
+// move rewrites a note at a new path and removes the old file.
+func (s *MarkdownStore) move(n *mdNote, to string) error {
+	from := n.path
+	n.path = to
+	if err := s.write(n); err != nil {
+		n.path = from
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	err := os.Remove(filepath.Join(s.dir, from))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// freePath returns a path in the given folder for a file with the given
+// name, numbering it if the name is taken.
+func (s *MarkdownStore) freePath(dir, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	p := filepath.Join(dir, name)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(s.dir, p)); os.IsNotExist(err) {
+			return p
+		}
+		p = filepath.Join(dir, fmt.Sprintf("%s %d%s", base, i, ext))
+	}
+}
+
+func (n *mdNote) live() bool {
+	return n.fm.Trashed.IsZero() && !strings.HasPrefix(n.path, mdHistoryDir+string(filepath.Separator))
+}
+
+func (n *mdNote) cell() *Cell {
+	c := &Cell{
+		id:         n.fm.ID,
+		ts:         n.fm.Updated.Unix(),
+		created:    n.fm.Created.Unix(),
+		data:       n.body,
+		supersedes: n.fm.Supersedes,
+		meta:       n.metadata(),
+		tags:       mergeTags(nil, n.fm.Tags),
+	}
+	if !n.fm.Trashed.IsZero() {
+		c.trashed = n.fm.Trashed.Unix()
+	}
+	return c
+}
+
+// explicitTags returns the tags in the note's front matter that aren't
+// #tags in its body, which were added by another tool.
+func (n *mdNote) explicitTags() []string {
+	body := make(map[string]bool)
+	for _, t := range ParseTags(n.body) {
+		body[t] = true
+	}
+
+	var tags []string
+	for _, t := range mergeTags(nil, n.fm.Tags) {
+		if !body[t] {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// metadata returns the note's front matter that holds a single value, with
+// its keys lower-cased as SetMetadata would. Keys that can't be metadata,
+// such as those brain keeps for itself, are left in the front matter but
+// not taken as metadata, so that they aren't indexed.
+func (n *mdNote) metadata() map[string]string {
+	var meta map[string]string
+	for k, v := range n.fm.Extra {
+		k, s, ok := metadataEntry(k, v)
+		if !ok {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[k] = s
+	}
+	return meta
+}
+
+// metadataFields returns the front matter for a cell with the given
+// metadata, keeping the front matter of the previous revision that isn't
+// metadata.
+func metadataFields(prev map[string]interface{}, meta map[string]string) map[string]interface{} {
+	fields := make(map[string]interface{}, len(prev)+len(meta))
+	for k, v := range prev {
+		if _, _, ok := metadataEntry(k, v); !ok {
+			fields[k] = v
+		}
+	}
+	for k, v := range meta {
+		fields[k] = v
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// metadataEntry returns an entry of front matter as a metadata key and
+// value, cleaned up as SetMetadata would, if it can be metadata.
+func metadataEntry(k string, v interface{}) (string, string, bool) {
+	s, ok := scalar(v)
+	k, s = strings.ToLower(strings.TrimSpace(k)), strings.TrimSpace(s)
+	return k, s, ok && s != "" && validMetadataKey(k)
+}
+
+// scalar formats a single value from front matter as a string.
+func scalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case int, int64, uint64, float64, bool:
+		return fmt.Sprint(v), true
+	case time.Time:
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format("2006-01-02"), true
+		}
+		return v.Format(time.RFC3339), true
+	}
+	return "", false
+}
+
+// parseNote splits a Markdown file into its front matter and body. A file
+// without front matter is all body.
+func parseNote(rel string, buf []byte) (*mdNote, error) {
+	n := &mdNote{path: rel}
+
+	buf = bytes.ReplaceAll(buf, []byte("\r\n"), []byte("\n"))
+	if !bytes.HasPrefix(buf, mdFence) {
+		n.body = string(buf)
+		return n, nil
+	}
+
+	rest := buf[len(mdFence):]
+	end := bytes.Index(rest, mdFence)
+	if end == -1 || (end > 0 && rest[end-1] != '\n') {
+		return nil, fmt.Errorf("%s: unterminated front matter", rel)
+	}
+	if err := yaml.Unmarshal(rest[:end], &n.fm); err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	n.body = string(rest[end+len(mdFence):])
+	return n, nil
+}
+
+// noteName returns the name of the file for a new cell, which is its
+// first line, or its identifier if that has nothing to name it by.
+func noteName(c *Cell) string {
+	line := c.data
+	if nl := strings.Index(line, "\n"); nl > -1 {
+		line = line[:nl]
+	}
+
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == ' ', r == '-', r == '_':
+			return r
+		}
+		return -1
+	}, line)
+	name = strings.Join(strings.Fields(name), " ")
+
+	if runes := []rune(name); len(runes) > mdNameLength {
+		name = strings.TrimSpace(string(runes[:mdNameLength]))
+	}
+	if name == "" {
+		name = c.id
+	}
+	return name + mdExt
+}
@@ -0,0 +1,163 @@
+package brain
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sno6/brain/search"
+)
+
+// mdFiles returns the paths of the Markdown files in dir, relative to it.
+func mdFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(p) == mdExt {
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestMarkdownCopiesBecomeCells(t *testing.T) {
+	dir := t.TempDir()
+	b, err := OpenMarkdown(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := writeCell(t, b, "original")
+	b.Close()
+
+	files := mdFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("files = %v, want one", files)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, files[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "copy.md"), buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = OpenMarkdown(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ids, err := b.search.IDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("indexed %v, want the copy as a cell of its own", ids)
+	}
+	for _, other := range ids {
+		if other == id {
+			continue
+		}
+		c, err := b.Read(other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Data() != "original" || c.Previous() != "" {
+			t.Errorf("copy = %q superseding %q, want %q with no history", c.Data(), c.Previous(), "original")
+		}
+	}
+}
+
+func TestMarkdownPurgeRemovesHistory(t *testing.T) {
+	dir := t.TempDir()
+	b, err := OpenMarkdown(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	id := writeCell(t, b, "first")
+	id = editCell(t, b, id, "second")
+	id = editCell(t, b, id, "third")
+	kept := writeCell(t, b, "kept")
+	editCell(t, b, kept, "kept again")
+	if n := len(mdFiles(t, dir)); n != 5 {
+		t.Fatalf("%d files, want 5", n)
+	}
+
+	if err := b.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Purge(id); err != nil {
+		t.Fatal(err)
+	}
+	if files := mdFiles(t, dir); len(files) != 2 {
+		t.Errorf("files = %v, want just the other cell and its history", files)
+	}
+}
+
+func TestMarkdownPicksUpExternalEdits(t *testing.T) {
+	dir := t.TempDir()
+	b, err := OpenMarkdown(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := writeCell(t, b, "written in brain")
+	b.Close()
+
+	fn := filepath.Join(dir, mdFiles(t, dir)[0])
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf = bytes.Replace(buf, []byte("written in brain"), []byte("edited elsewhere"), 1)
+	if err := ioutil.WriteFile(fn, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(fn, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "new.md"), []byte("added elsewhere"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = OpenMarkdown(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	c, err := b.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Data() != "edited elsewhere" {
+		t.Errorf("edited cell = %q, want %q", c.Data(), "edited elsewhere")
+	}
+	if c.Timestamp().Unix() != later.Unix() {
+		t.Errorf("edited cell updated at %v, want the file's modification time %v", c.Timestamp(), later)
+	}
+
+	for _, q := range []string{"edited", "added"} {
+		page, err := b.List(search.Request{Query: q})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 1 {
+			t.Errorf("searching for %q found %d cells, want 1", q, page.Total)
+		}
+	}
+}
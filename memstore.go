@@ -0,0 +1,100 @@
+package brain
+
+import "fmt"
+
+// A MemStore is a Store that keeps cells in memory, for tests and for
+// embedding a Brain that doesn't need to outlive the process.
+type MemStore struct {
+	cells map[string]*Cell
+	order []string
+	trash map[string]int64
+}
+
+// NewMemStore returns an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		cells: make(map[string]*Cell),
+		trash: make(map[string]int64),
+	}
+}
+
+// Append stores a copy of the cell.
+func (m *MemStore) Append(c *Cell) error {
+	cell := *c
+	cell.trashed = 0
+	m.cells[c.id] = &cell
+	m.order = append(m.order, c.id)
+	return nil
+}
+
+// Read returns a copy of the cell with the given identifier.
+func (m *MemStore) Read(id string) (*Cell, error) {
+	c, ok := m.cells[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCell, id)
+	}
+
+	cell := *c
+	cell.trashed = m.trash[id]
+	return &cell, nil
+}
+
+// Iterate calls fn with a copy of every cell in the order they were
+// appended.
+func (m *MemStore) Iterate(fn func(*Cell) error) error {
+	for _, id := range m.order {
+		cell, err := m.Read(id)
+		if err != nil {
+			return err
+		}
+		if err := fn(cell); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete forgets a cell.
+func (m *MemStore) Delete(id string) error {
+	if _, ok := m.cells[id]; !ok {
+		return nil
+	}
+	delete(m.cells, id)
+	delete(m.trash, id)
+
+	for i, other := range m.order {
+		if other == id {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// SetTrashed moves a cell to the trash at ts, or out of it if ts is 0.
+func (m *MemStore) SetTrashed(id string, ts int64) error {
+	if _, ok := m.cells[id]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCell, id)
+	}
+	if ts == 0 {
+		delete(m.trash, id)
+	} else {
+		m.trash[id] = ts
+	}
+	return nil
+}
+
+// Trashed returns when each cell in the trash was moved there.
+func (m *MemStore) Trashed() (map[string]int64, error) {
+	trash := make(map[string]int64, len(m.trash))
+	for id, ts := range m.trash {
+		trash[id] = ts
+	}
+	return trash, nil
+}
+
+// Close does nothing, the cells are kept until the store is garbage
+// collected.
+func (m *MemStore) Close() error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package brain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemStoreReopens(t *testing.T) {
+	s := NewMemStore()
+	b, err := OpenStore(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := writeCell(t, b, "first")
+	edited := editCell(t, b, first, "edited")
+	trashed := writeCell(t, b, "trashed")
+	if err := b.Delete(trashed); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The index is rebuilt from the store's cells.
+	b, err = OpenStore(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ids, err := b.indexedIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || !ids[edited] {
+		t.Errorf("indexed %v, want only %s", ids, edited)
+	}
+	if c, err := b.Read(first); err != nil || c.Data() != "first" {
+		t.Errorf("reading earlier revision: %v, %v", c, err)
+	}
+
+	trash, err := b.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].Identifier() != trashed {
+		t.Errorf("trash holds %d cells, want only %s", len(trash), trashed)
+	}
+}
+
+func TestOpenStoreRefusesPassphrase(t *testing.T) {
+	if _, err := OpenStore(NewMemStore(), WithPassphrase("hunter2")); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("OpenStore with a passphrase = %v, want ErrNotSupported", err)
+	}
+}
@@ -0,0 +1,93 @@
+package brain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/sno6/brain/search"
+)
+
+// ErrInvalidMetadata is returned when setting metadata with a key that
+// can't be searched for.
+var ErrInvalidMetadata = errors.New("invalid metadata key")
+
+// Metadata keys that are taken by what brain keeps about every cell.
+var reservedMetadata = map[string]bool{
+	search.ContentField:    true,
+	"id":                   true,
+	"created":              true,
+	"updated":              true,
+	"tags":                 true,
+	search.TagField:        true,
+	search.LinkField:       true,
+	search.NameField:       true,
+	search.AttachmentField: true,
+	search.ViewedField:     true,
+	"supersedes":           true,
+	"trashed":              true,
+	"origin":               true,
+}
+
+// SetMetadata replaces the metadata of the cell with the given identifier,
+// such as its title, source or author, see Cell.Metadata. Like Edit, it
+// writes a new revision of the cell. Keys are lower-cased, and keys with
+// an empty value are left out.
+//
+// Each key is indexed as a field of its own, so that cells can be searched
+// for by it with key:value, as in source:github.com.
+func (b *Brain) SetMetadata(id string, meta map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	meta, err := cleanMetadata(meta)
+	if err != nil {
+		return err
+	}
+	prev, err := b.read(id)
+	if err != nil {
+		return err
+	}
+	return b.revise(prev, prev.data, meta)
+}
+
+// cleanMetadata returns metadata with its keys lower-cased and trimmed,
+// and without empty values. Keys may only hold letters, digits, dashes
+// and underscores, and mustn't be one brain keeps for itself.
+func cleanMetadata(meta map[string]string) (map[string]string, error) {
+	clean := make(map[string]string, len(meta))
+	for k, v := range meta {
+		k = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !validMetadataKey(k) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidMetadata, k)
+		}
+		clean[k] = v
+	}
+	if len(clean) == 0 {
+		return nil, nil
+	}
+	return clean, nil
+}
+
+// validMetadataKey reports whether a lower-cased key can be used for
+// metadata.
+func validMetadataKey(k string) bool {
+	if k == "" || reservedMetadata[k] {
+		return false
+	}
+	for _, r := range k {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
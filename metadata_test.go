@@ -0,0 +1,43 @@
+package brain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sno6/brain/search"
+)
+
+func TestSetMetadata(t *testing.T) {
+	b, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	id := writeCell(t, b, "an article")
+
+	err = b.SetMetadata(id, map[string]string{" Source ": "github.com", "author": "  "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := b.List(search.Request{Query: "source:github.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 {
+		t.Fatalf("source:github.com found %d cells, want 1", page.Total)
+	}
+	c := page.Hits[0].Cell
+	if c.Previous() != id || c.Data() != "an article" {
+		t.Errorf("cell with metadata = %q superseding %q, want a new revision of %s", c.Data(), c.Previous(), id)
+	}
+	if meta := c.Metadata(); len(meta) != 1 || meta["source"] != "github.com" {
+		t.Errorf("metadata = %v, want only source: github.com", meta)
+	}
+
+	for _, key := range []string{"tags", "created", "two words", "key:value"} {
+		err := b.SetMetadata(c.Identifier(), map[string]string{key: "x"})
+		if !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("setting %q = %v, want ErrInvalidMetadata", key, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The .data file starts with a header made up of a magic string and a
+// format version, followed by back to back records. Each record is framed
+// as:
+//
+//	length  uint32  length of the payload in bytes
+//	flags   uint8   flags describing how the payload is encoded
+//	crc     uint32  CRC32 (IEEE) of the flags and payload
+//	payload []byte
+//
+// All integers are big endian. The flags are:
+//
+//	flagSealed      the payload is encrypted, see Encrypt
+//	flagCompressed  the payload is gzipped, see WithCompression
+//
+// A payload that is both is compressed before it is sealed.
+//
+// Version 2 added tombstone records for deleted cells, which version 1
+// files are missing.
+const (
+	formatMagic   = "BRAIN\x00"
+	formatVersion = 2
+
+	headerSize       = int64(len(formatMagic) + 2)
+	recordHeaderSize = 9
+)
+
+// Record flags.
+const (
+	flagSealed uint8 = 1 << iota
+	flagCompressed
+)
+
+var (
+	// ErrCorruptRecord is returned when a record fails its checksum or
+	// its framing doesn't match the data that was read.
+	ErrCorruptRecord = errors.New("corrupt record")
+
+	// ErrUnsupportedVersion is returned when .data was written by a newer
+	// version of brain.
+	ErrUnsupportedVersion = errors.New("unsupported data file version")
+)
+
+// writeHeader writes the .data file header to w.
+func writeHeader(w io.Writer) error {
+	buf := make([]byte, headerSize)
+	copy(buf, formatMagic)
+	binary.BigEndian.PutUint16(buf[len(formatMagic):], formatVersion)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readVersion returns the format version from the header of the data in
+// r. Files written before the framed format existed have no header and
+// are reported as version 0.
+func readVersion(r io.ReaderAt) (int, error) {
+	buf := make([]byte, headerSize)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		if err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if !bytes.Equal(buf[:len(formatMagic)], []byte(formatMagic)) {
+		return 0, nil
+	}
+	v := int(binary.BigEndian.Uint16(buf[len(formatMagic):]))
+	if v > formatVersion {
+		return 0, fmt.Errorf("%w: %d", ErrUnsupportedVersion, v)
+	}
+	return v, nil
+}
+
+// frame wraps a payload in a record header.
+func frame(flags uint8, payload []byte) []byte {
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	buf[4] = flags
+	copy(buf[recordHeaderSize:], payload)
+	binary.BigEndian.PutUint32(buf[5:9], checksum(buf[4:5], payload))
+	return buf
+}
+
+// unframe validates a complete record and returns its flags and payload.
+func unframe(buf []byte) (uint8, []byte, error) {
+	if len(buf) < recordHeaderSize {
+		return 0, nil, fmt.Errorf("%w: short record header", ErrCorruptRecord)
+	}
+
+	n := binary.BigEndian.Uint32(buf[0:4])
+	if int(n) != len(buf)-recordHeaderSize {
+		return 0, nil, fmt.Errorf("%w: length mismatch", ErrCorruptRecord)
+	}
+
+	payload := buf[recordHeaderSize:]
+	if binary.BigEndian.Uint32(buf[5:9]) != checksum(buf[4:5], payload) {
+		return 0, nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptRecord)
+	}
+	return buf[4], payload, nil
+}
+
+func checksum(flags, payload []byte) uint32 {
+	crc := crc32.ChecksumIEEE(flags)
+	return crc32.Update(crc, crc32.IEEETable, payload)
+}
+
+// A recordScanner walks the framed records in .data in order. It only
+// checks that each record fits in the file, it's up to the caller to
+// validate the record itself.
+type recordScanner struct {
+	r    io.ReaderAt
+	size int64
+
+	offset int64
+	cur    int64
+	rec    []byte
+	err    error
+}
+
+func newRecordScanner(r io.ReaderAt, size int64) *recordScanner {
+	return &recordScanner{r: r, size: size, offset: headerSize}
+}
+
+// next advances to the next record. It returns false once there are no
+// more records or the scanner hits an error.
+func (s *recordScanner) next() bool {
+	if s.err != nil || s.offset >= s.size {
+		return false
+	}
+
+	s.cur = s.offset
+	if s.size-s.cur < recordHeaderSize {
+		s.err = fmt.Errorf("%w: truncated record header", ErrCorruptRecord)
+		return false
+	}
+
+	hdr := make([]byte, recordHeaderSize)
+	if _, err := s.r.ReadAt(hdr, s.cur); err != nil {
+		s.err = err
+		return false
+	}
+
+	n := int64(binary.BigEndian.Uint32(hdr[0:4]))
+	if s.size-s.cur-recordHeaderSize < n {
+		s.err = fmt.Errorf("%w: truncated record", ErrCorruptRecord)
+		return false
+	}
+
+	s.rec = make([]byte, recordHeaderSize+n)
+	if _, err := s.r.ReadAt(s.rec, s.cur); err != nil {
+		s.err = err
+		return false
+	}
+
+	s.offset = s.cur + int64(len(s.rec))
+	return true
+}
+
+// record returns the offset and bytes of the current record.
+func (s *recordScanner) record() (int64, []byte) {
+	return s.cur, s.rec
+}
+
+// seek moves the scanner so the next record is read from offset, clearing
+// any error it stopped on.
+func (s *recordScanner) seek(offset int64) {
+	s.offset = offset
+	s.err = nil
+}
+
+// nextRecord returns where the first intact record after the one at
+// offset starts, to carry on reading r from after a corrupt record. The
+// length of a corrupt record can't be trusted, so every offset after it
+// is tried in turn until a record there fits before size and its
+// checksum matches. It reports false if there is no such record.
+func nextRecord(r io.ReaderAt, offset, size int64) (int64, bool, error) {
+	if offset >= size {
+		return 0, false, nil
+	}
+	buf := make([]byte, size-offset)
+	if _, err := r.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return 0, false, err
+	}
+
+	for i := 1; i+recordHeaderSize <= len(buf); i++ {
+		end := int64(i) + recordHeaderSize + int64(binary.BigEndian.Uint32(buf[i:i+4]))
+		if end > int64(len(buf)) {
+			continue
+		}
+		if _, _, err := unframe(buf[i:end]); err == nil {
+			return offset + int64(i), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// failedAt returns the offset of the record the scanner stopped on, along
+// with the reason it stopped, if it stopped early.
+func (s *recordScanner) failedAt() (int64, error) {
+	return s.cur, s.err
+}
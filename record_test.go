@@ -0,0 +1,57 @@
+package brain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	for _, flags := range []uint8{0, flagCompressed, flagSealed, flagSealed | flagCompressed} {
+		for _, payload := range [][]byte{{}, []byte("hello"), bytes.Repeat([]byte{0xff}, 1024)} {
+			gotFlags, got, err := unframe(frame(flags, payload))
+			if err != nil {
+				t.Fatalf("unframe(frame(%d, %d bytes)): %v", flags, len(payload), err)
+			}
+			if gotFlags != flags {
+				t.Errorf("flags = %d, want %d", gotFlags, flags)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Errorf("payload = %q, want %q", got, payload)
+			}
+		}
+	}
+}
+
+func TestUnframeRejectsCorruptRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func([]byte) []byte
+	}{
+		{"payload", func(buf []byte) []byte { buf[len(buf)-1] ^= 1; return buf }},
+		{"flags", func(buf []byte) []byte { buf[4] ^= flagCompressed; return buf }},
+		{"checksum", func(buf []byte) []byte { buf[5] ^= 1; return buf }},
+		{"length", func(buf []byte) []byte { buf[3]++; return buf }},
+		{"truncated", func(buf []byte) []byte { return buf[:len(buf)-1] }},
+		{"header", func(buf []byte) []byte { return buf[:recordHeaderSize-1] }},
+	}
+	for _, tt := range tests {
+		buf := tt.corrupt(frame(0, []byte("hello")))
+		if _, _, err := unframe(buf); !errors.Is(err, ErrCorruptRecord) {
+			t.Errorf("%s: unframe() error = %v, want %v", tt.name, err, ErrCorruptRecord)
+		}
+	}
+}
+
+func TestReadVersion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeHeader(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := readVersion(bytes.NewReader(buf.Bytes())); err != nil || v != formatVersion {
+		t.Errorf("readVersion(header) = %d, %v, want %d", v, err, formatVersion)
+	}
+	if v, err := readVersion(bytes.NewReader([]byte("1600000000 hello"))); err != nil || v != 0 {
+		t.Errorf("readVersion(legacy) = %d, %v, want 0", v, err)
+	}
+}
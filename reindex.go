@@ -0,0 +1,225 @@
+package brain
+
+import (
+	"os"
+	"path"
+
+	"github.com/sno6/brain/search"
+)
+
+const (
+	reindexTableFn = ".offsets.reindex"
+
+	// How many cells to index in a single batch when reindexing.
+	reindexBatchSize = 500
+)
+
+// A replayedCell is a cell found by replaying .data, along with where its
+// record lives and whether it is live or has been superseded by an edit.
+// A live cell may also be in the trash.
+type replayedCell struct {
+	cell *Cell
+	loc  location
+	live bool
+}
+
+// indexed reports whether the cell belongs in the index.
+func (rc *replayedCell) indexed() bool {
+	return rc.live && rc.cell.trashed == 0
+}
+
+// Reindex throws away the index and rebuilds it from the cells in the
+// store. For a brain that keeps its cells in .data, the offset table is
+// rebuilt along with it by replaying .data. It returns the number of cells
+// indexed.
+func (b *Brain) Reindex() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return 0, ErrReadOnly
+	}
+	return b.reindex()
+}
+
+func (b *Brain) reindex() (int, error) {
+	b.forgetSuccessors()
+	cells, err := b.storedCells()
+	if err != nil {
+		return 0, err
+	}
+	if b.fs != nil {
+		if err := b.fs.rewriteTable(cells); err != nil {
+			return 0, err
+		}
+	}
+	if err := b.search.Reset(); err != nil {
+		return 0, err
+	}
+	return b.indexCells(cells)
+}
+
+// upgradeIndex rebuilds the index if it was built by an earlier version of
+// brain that indexed cells differently.
+func (b *Brain) upgradeIndex() error {
+	outdated, err := b.search.Outdated()
+	if err != nil || !outdated {
+		return err
+	}
+	_, err = b.reindex()
+	return err
+}
+
+// indexCells indexes the replayed cells that belong in the index in
+// batches, and returns how many there were.
+func (b *Brain) indexCells(cells map[string]*replayedCell) (int, error) {
+	var n int
+	batch := b.search.NewBatch()
+	for id, rc := range cells {
+		if !rc.indexed() {
+			continue
+		}
+		n++
+
+		// Every revision is at hand, so there's no need to read them again
+		// to find when the cell was created.
+		if rc.cell.created == 0 {
+			first := rc.cell
+			for first.created == 0 && cells[first.supersedes] != nil {
+				first = cells[first.supersedes].cell
+			}
+			rc.cell.created = first.created
+			if first.created == 0 {
+				rc.cell.created = first.ts
+			}
+		}
+
+		if err := batch.Index(id, b.document(rc.cell)); err != nil {
+			return 0, err
+		}
+		if batch.Size() < reindexBatchSize {
+			continue
+		}
+		if err := batch.Commit(); err != nil {
+			return 0, err
+		}
+		batch = b.search.NewBatch()
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// storedCells returns every cell in the store, noting which are live.
+func (b *Brain) storedCells() (map[string]*replayedCell, error) {
+	if b.fs != nil {
+		return b.fs.replay(&Report{})
+	}
+
+	// Cells edited by other tools may be newer than the cells that
+	// supersede them, so revisions are only marked once all are known.
+	cells := make(map[string]*replayedCell)
+	err := b.store.Iterate(func(c *Cell) error {
+		cells[c.id] = &replayedCell{cell: c, live: true}
+		return nil
+	})
+	for _, rc := range cells {
+		if prev, ok := cells[rc.cell.supersedes]; ok {
+			prev.live = false
+		}
+	}
+	return cells, err
+}
+
+// DropIndex deletes the index of the brain in the given folder, so that
+// it can be rebuilt with Reindex when it is too damaged to open. It fails
+// with a *LockedError if another process has the brain open.
+func DropIndex(dir string) error {
+	lock, err := acquireLock(dir)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	return search.Remove(dir)
+}
+
+// replay walks .data from the start, applying every cell, edit, trash,
+// restore and purge record in order, and returns the cells that are left,
+// either live or kept as earlier revisions of another cell.
+func (s *fileStore) replay(report *Report) (map[string]*replayedCell, error) {
+	cells := make(map[string]*replayedCell)
+	err := s.walkRecords(report, func(loc location, r *cellRecord) {
+		switch r.Kind {
+		case kindCell:
+			if prev, ok := cells[r.Supersedes]; ok {
+				prev.live = false
+			}
+			cells[r.ID] = &replayedCell{cell: r.cell(loc.offset), loc: loc, live: true}
+		case kindTombstone:
+			if rc, ok := cells[r.ID]; ok {
+				rc.cell.trashed = r.TS
+			}
+		case kindRestore:
+			if rc, ok := cells[r.ID]; ok {
+				rc.cell.trashed = 0
+			}
+		case kindPurge:
+			delete(cells, r.ID)
+		}
+	})
+	return cells, err
+}
+
+// rewriteTable replaces the offset table with one holding just the given
+// cells.
+func (s *fileStore) rewriteTable(cells map[string]*replayedCell) error {
+	aliases := make(map[string]string, len(s.table.aliases))
+	for legacy, stable := range s.table.aliases {
+		aliases[stable] = legacy
+	}
+
+	tmpPath := path.Join(s.dir, reindexTableFn)
+	tmp, err := createTemp(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	for id, rc := range cells {
+		alias := rc.cell.legacyID
+		if alias == "" {
+			alias = aliases[id]
+		}
+		if _, err = writeTableEntry(tmp, id, rc.loc, alias); err != nil {
+			break
+		}
+		if rc.cell.trashed == 0 {
+			continue
+		}
+		if _, err = writeTrashEntry(tmp, id, rc.cell.trashed); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path.Join(s.dir, tableFn))
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	table, err := openTable(s.dir)
+	if err != nil {
+		return err
+	}
+	s.table.close()
+	s.table = table
+	return nil
+}
@@ -0,0 +1,166 @@
+package brain
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"testing"
+)
+
+// replayCells are the cells written by writeReplayCells.
+type replayCells struct {
+	live, trashed, restored, purged, edited, revision string
+}
+
+// editCell edits a cell and returns the identifier of its new revision.
+func editCell(t *testing.T, b *Brain, id, s string) string {
+	t.Helper()
+
+	if err := b.Edit(id, s); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := b.search.IDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rev := range ids {
+		if c, err := b.Read(rev); err == nil && c.Previous() == id {
+			return rev
+		}
+	}
+	t.Fatalf("editing %s didn't index a new revision", id)
+	return ""
+}
+
+// writeReplayCells writes a cell for each kind of record replay handles.
+func writeReplayCells(t *testing.T, b *Brain) replayCells {
+	t.Helper()
+
+	var rc replayCells
+	rc.live = writeCell(t, b, "live")
+	rc.trashed = writeCell(t, b, "trashed")
+	rc.restored = writeCell(t, b, "restored")
+	rc.purged = writeCell(t, b, "purged")
+	rc.edited = writeCell(t, b, "edited")
+
+	for _, id := range []string{rc.trashed, rc.restored, rc.purged} {
+		if err := b.Delete(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Restore(rc.restored); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Purge(rc.purged); err != nil {
+		t.Fatal(err)
+	}
+
+	rc.revision = editCell(t, b, rc.edited, "revision")
+	return rc
+}
+
+func TestReplay(t *testing.T) {
+	b, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	rc := writeReplayCells(t, b)
+
+	report := &Report{}
+	cells, err := b.fs.replay(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unparsable) != 0 || report.TruncatedAt != 0 {
+		t.Errorf("replay reported %+v, want every record read", report)
+	}
+
+	tests := []struct {
+		id            string
+		live, trashed bool
+	}{
+		{rc.live, true, false},
+		{rc.trashed, true, true},
+		{rc.restored, true, false},
+		{rc.edited, false, false},
+		{rc.revision, true, false},
+	}
+	for _, tt := range tests {
+		c, ok := cells[tt.id]
+		if !ok {
+			t.Errorf("%s missing from replay", tt.id)
+			continue
+		}
+		if c.live != tt.live || (c.cell.trashed != 0) != tt.trashed {
+			t.Errorf("%q: live %v, trashed %v, want live %v, trashed %v", c.cell.Data(), c.live, c.cell.trashed != 0, tt.live, tt.trashed)
+		}
+	}
+	if _, ok := cells[rc.purged]; ok {
+		t.Error("purged cell is still there after replay")
+	}
+	if len(cells) != len(tests) {
+		t.Errorf("replay found %d cells, want %d", len(cells), len(tests))
+	}
+}
+
+func TestReindexRebuildsIndexAndTable(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := writeReplayCells(t, b)
+	b.Close()
+
+	if err := DropIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path.Join(dir, tableFn)); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	n, err := b.Reindex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("Reindex() indexed %d cells, want 3", n)
+	}
+
+	ids, err := b.search.IDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{rc.live, rc.restored, rc.revision}
+	sort.Strings(ids)
+	sort.Strings(want)
+	if len(ids) != len(want) {
+		t.Fatalf("indexed %v, want %v", ids, want)
+	}
+	for i := range ids {
+		if ids[i] != want[i] {
+			t.Fatalf("indexed %v, want %v", ids, want)
+		}
+	}
+
+	trash, err := b.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].Identifier() != rc.trashed {
+		t.Errorf("trash holds %d cells, want just %s", len(trash), rc.trashed)
+	}
+	if _, err := b.Read(rc.purged); !errors.Is(err, ErrUnknownCell) {
+		t.Errorf("Read(purged) error = %v, want %v", err, ErrUnknownCell)
+	}
+	if c, err := b.Read(rc.edited); err != nil || c.Data() != "edited" {
+		t.Errorf("Read(earlier revision) = %v, want it kept", err)
+	}
+}
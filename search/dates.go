@@ -0,0 +1,112 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const (
+	// CreatedField is the field when a document's cell was first written
+	// is indexed under.
+	CreatedField = "created"
+
+	// UpdatedField is the field when a document's cell was last changed is
+	// indexed under.
+	UpdatedField = "updated"
+)
+
+// ErrInvalidDate is returned by Query for a date filter it can't make
+// sense of.
+var ErrInvalidDate = errors.New("invalid date")
+
+// Layouts that dates in filters may be written in, from the most precise.
+// Dates without a time zone are in the local one.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// dateFilter returns the query for a filter on a date field, which is a
+// date optionally preceded by one of >, >=, < or <=, or a range of dates
+// separated by "..", inclusive at both ends. A date without a time stands
+// for the whole day, so created:>2022-01-01 matches from 2022-01-02 on.
+func dateFilter(field, value string) (query.Query, error) {
+	var start, end time.Time
+	var err error
+
+	if i := strings.Index(value, ".."); i > -1 {
+		var from, to [2]time.Time
+		if from, err = parseDate(value[:i]); err != nil {
+			return nil, err
+		}
+		if to, err = parseDate(value[i+2:]); err != nil {
+			return nil, err
+		}
+		start, end = from[0], to[1]
+	} else {
+		var op string
+		for _, o := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(value, o) {
+				op = o
+				break
+			}
+		}
+		span, err := parseDate(value[len(op):])
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case ">":
+			start = span[1]
+		case ">=":
+			start = span[0]
+		case "<":
+			end = span[0]
+		case "<=":
+			end = span[1]
+		default:
+			start, end = span[0], span[1]
+		}
+	}
+
+	inclusive, exclusive := true, false
+	q := bleve.NewDateRangeInclusiveQuery(start, end, &inclusive, &exclusive)
+	q.SetField(field)
+	return q, nil
+}
+
+// parseDate returns the span of time that a date covers, which starts at
+// the date and ends where the next one of the same precision would start.
+func parseDate(s string) ([2]time.Time, error) {
+	for _, layout := range dateLayouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+
+		var end time.Time
+		switch layout {
+		case "2006":
+			end = t.AddDate(1, 0, 0)
+		case "2006-01":
+			end = t.AddDate(0, 1, 0)
+		case "2006-01-02":
+			end = t.AddDate(0, 0, 1)
+		case "2006-01-02T15:04":
+			end = t.Add(time.Minute)
+		default:
+			end = t.Add(time.Second)
+		}
+		return [2]time.Time{t, end}, nil
+	}
+	return [2]time.Time{}, fmt.Errorf("%w %q, expected a date such as 2022-01-31", ErrInvalidDate, s)
+}
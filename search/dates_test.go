@@ -0,0 +1,122 @@
+package search
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestIndex returns an index in memory holding the given documents.
+func newTestIndex(t *testing.T, docs map[string]Document) *Search {
+	t.Helper()
+
+	s, err := NewMemOnly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, doc := range docs {
+		if err := s.Index(id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// queryIDs returns the ids of the documents that match a query, sorted.
+func queryIDs(t *testing.T, s *Search, qs string, mode Mode) ([]string, error) {
+	t.Helper()
+
+	res, err := s.Query(Request{Query: qs, Mode: mode})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(res.Hits))
+	for i, h := range res.Hits {
+		ids[i] = h.ID
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func day(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02T15:04", s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		date       string
+		start, end time.Time
+	}{
+		{"2022", day("2022-01-01T00:00"), day("2023-01-01T00:00")},
+		{"2022-03", day("2022-03-01T00:00"), day("2022-04-01T00:00")},
+		{"2022-03-04", day("2022-03-04T00:00"), day("2022-03-05T00:00")},
+		{"2022-03-04T10:30", day("2022-03-04T10:30"), day("2022-03-04T10:31")},
+		{"2022-03-04T10:30:15", day("2022-03-04T10:30").Add(15 * time.Second), day("2022-03-04T10:30").Add(16 * time.Second)},
+		{"2022-03-04T10:30:00Z", time.Date(2022, 3, 4, 10, 30, 0, 0, time.UTC), time.Date(2022, 3, 4, 10, 30, 1, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		span, err := parseDate(tt.date)
+		if err != nil {
+			t.Errorf("parseDate(%q): %v", tt.date, err)
+			continue
+		}
+		if !span[0].Equal(tt.start) || !span[1].Equal(tt.end) {
+			t.Errorf("parseDate(%q) = %v to %v, want %v to %v", tt.date, span[0], span[1], tt.start, tt.end)
+		}
+	}
+
+	for _, date := range []string{"", "yesterday", "2022-13", "04/03/2022"} {
+		if _, err := parseDate(date); !errors.Is(err, ErrInvalidDate) {
+			t.Errorf("parseDate(%q) = %v, want ErrInvalidDate", date, err)
+		}
+	}
+}
+
+func TestDateFilters(t *testing.T) {
+	s := newTestIndex(t, map[string]Document{
+		"jan1": {Content: "hello", Created: day("2022-01-01T12:00"), Updated: day("2022-03-01T12:00")},
+		"jan2": {Content: "hello", Created: day("2022-01-02T12:00"), Updated: day("2022-01-02T12:00")},
+		"feb1": {Content: "goodbye", Created: day("2022-02-01T12:00"), Updated: day("2022-02-01T12:00")},
+	})
+	defer s.Close()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"created:2022-01-01", "jan1"},
+		{"created:=2022-01-01", "jan1"},
+		{"created:>2022-01-01", "feb1 jan2"},
+		{"created:>=2022-01-02", "feb1 jan2"},
+		{"created:<2022-01-02", "jan1"},
+		{"created:<=2022-01-02", "jan1 jan2"},
+		{"created:2022-01", "jan1 jan2"},
+		{"created:2022-01-02..2022-02", "feb1 jan2"},
+		{`created:"2022-01-01T12:00"`, "jan1"},
+		{"updated:>2022-02-15", "jan1"},
+		{"hello created:>2022-01-01", "jan2"},
+		{"created:2021", ""},
+	}
+	for _, tt := range tests {
+		ids, err := queryIDs(t, s, tt.query, Keyword)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("%s matched %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	for _, qs := range []string{"created:yesterday", "updated:>soon", "created:2022..later"} {
+		if _, err := queryIDs(t, s, qs, Keyword); !errors.Is(err, ErrInvalidDate) {
+			t.Errorf("%s = %v, want ErrInvalidDate", qs, err)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const (
+	// indexVersion is bumped whenever what is indexed for a document
+	// changes, so that indexes built by earlier versions are rebuilt.
+	indexVersion = "8"
+
+	// versionKey is where the version is kept in the index's internal
+	// key/value store.
+	versionKey = "version"
+
+	// ContentField is the field a document's content is indexed under.
+	ContentField = "content"
+
+	// TagField is the field a document's tags are indexed under, each as
+	// a single term.
+	TagField = "tag"
+
+	// LinkField is the field the [[links]] in a document are indexed
+	// under, each as a single term.
+	LinkField = "link"
+
+	// NameField is the field the names that a document can be linked to
+	// by are indexed under, each as a single term.
+	NameField = "linkname"
+
+	// AttachmentField is the field the text of a document's attachments
+	// is indexed under.
+	AttachmentField = "attachment"
+)
+
+// ErrInvalidQuery is returned by Query for a query in the Advanced mode
+// that can't be parsed.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// A Document is what is indexed for a cell: its content, its tags, and
+// metadata that is indexed under a field of its own for each key, so that
+// it can be searched for with key:value, as in source:github.com.
+//
+// Links and Names are what the document links to and the names it can be
+// linked to by, which are found with WithTerms rather than by searching.
+// Attachments are the text of files attached to it, which is searched
+// along with its content. Created and Updated can be filtered on with
+// created:>2022-01-01 and the like, see Query.
+type Document struct {
+	Content     string
+	Created     time.Time
+	Updated     time.Time
+	Tags        []string
+	Meta        map[string]string
+	Links       []string
+	Names       []string
+	Attachments []string
+}
+
+// Fields that metadata can't be indexed under, since they are taken by
+// what's indexed for every document.
+var documentFields = map[string]bool{
+	ContentField: true, CreatedField: true, UpdatedField: true,
+	TagField: true, LinkField: true, NameField: true,
+	AttachmentField: true, ViewedField: true,
+}
+
+// fields returns the document as bleve indexes it.
+func (d Document) fields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(d.Meta)+7)
+	for k, v := range d.Meta {
+		if !documentFields[k] {
+			fields[k] = v
+		}
+	}
+	fields[ContentField] = d.Content
+	if !d.Created.IsZero() {
+		fields[CreatedField] = d.Created
+	}
+	if !d.Updated.IsZero() {
+		fields[UpdatedField] = d.Updated
+	}
+	if len(d.Tags) > 0 {
+		fields[TagField] = d.Tags
+	}
+	if len(d.Links) > 0 {
+		fields[LinkField] = d.Links
+	}
+	if len(d.Names) > 0 {
+		fields[NameField] = d.Names
+	}
+	if len(d.Attachments) > 0 {
+		fields[AttachmentField] = d.Attachments
+	}
+	return fields
+}
+
+// newMapping returns how documents are indexed.
+func newMapping() mapping.IndexMapping {
+	terms := bleve.NewTextFieldMapping()
+	terms.Analyzer = keyword.Name
+
+	dates := bleve.NewDateTimeFieldMapping()
+
+	m := bleve.NewIndexMapping()
+	for _, f := range []string{TagField, LinkField, NameField} {
+		m.DefaultMapping.AddFieldMappingsAt(f, terms)
+	}
+	for _, f := range []string{CreatedField, UpdatedField, ViewedField} {
+		m.DefaultMapping.AddFieldMappingsAt(f, dates)
+	}
+	return m
+}
+
+// A Tag is a tag along with how many documents have it.
+type Tag struct {
+	Name  string
+	Count int
+}
+
+// Tags returns every tag in the index, the most used first.
+func (s *Search) Tags() ([]Tag, error) {
+	dict, err := s.index.FieldDict(TagField)
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	for {
+		entry, err := dict.Next()
+		if err != nil {
+			dict.Close()
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		n++
+	}
+	if err := dict.Close(); err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	// The dictionary's counts include deleted documents until segments
+	// are merged, so they are counted with a facet instead.
+	r := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	r.Size = 0
+	r.AddFacet(TagField, bleve.NewFacetRequest(TagField, n))
+	res, err := s.index.Search(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []Tag
+	if f, ok := res.Facets[TagField]; ok && f.Terms != nil {
+		for _, t := range f.Terms.Terms() {
+			tags = append(tags, Tag{Name: t.Term, Count: t.Count})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+// Outdated reports whether the index was built by an earlier version that
+// indexed documents differently, and needs to be rebuilt with Reset.
+func (s *Search) Outdated() (bool, error) {
+	v, err := s.index.GetInternal([]byte(versionKey))
+	if err != nil {
+		return false, err
+	}
+	return string(v) != indexVersion, nil
+}
+
+// setVersion marks a new index as built by this version.
+func setVersion(index bleve.Index) error {
+	return index.SetInternal([]byte(versionKey), []byte(indexVersion))
+}
+
+// splitFilters picks the key:value terms out of a query string whose key
+// is a field of the index, and returns the rest of the query along with a
+// query for each of them. Values may be quoted to include spaces. Filters
+// on dates that can't be parsed fail with ErrInvalidDate.
+func (s *Search) splitFilters(qs string) (string, []query.Query, error) {
+	terms := splitTerms(qs)
+	if len(terms) == 0 {
+		return qs, nil, nil
+	}
+
+	names, err := s.index.Fields()
+	if err != nil {
+		return "", nil, err
+	}
+	fields := make(map[string]bool, len(names))
+	for _, f := range names {
+		fields[f] = true
+	}
+	delete(fields, ContentField)
+	delete(fields, "_all")
+
+	// Tags and dates are always filters, even before anything has them.
+	fields[TagField] = true
+	fields[CreatedField] = true
+	fields[UpdatedField] = true
+
+	var rest []string
+	var filters []query.Query
+	for _, t := range terms {
+		i := strings.Index(t, ":")
+		if i < 1 || i == len(t)-1 || !fields[t[:i]] {
+			rest = append(rest, t)
+			continue
+		}
+
+		key, value := t[:i], strings.Trim(t[i+1:], `"`)
+		switch key {
+		case CreatedField, UpdatedField:
+			q, err := dateFilter(key, value)
+			if err != nil {
+				return "", nil, err
+			}
+			filters = append(filters, q)
+			continue
+		case TagField:
+			tq := bleve.NewTermQuery(strings.ToLower(strings.TrimPrefix(value, "#")))
+			tq.SetField(TagField)
+			filters = append(filters, tq)
+			continue
+		}
+
+		q := bleve.NewMatchPhraseQuery(value)
+		q.SetField(key)
+		filters = append(filters, q)
+	}
+	return strings.Join(rest, " "), filters, nil
+}
+
+// splitTerms splits a query string on spaces that aren't within quotes.
+func splitTerms(qs string) []string {
+	var terms []string
+	var quoted bool
+	start := -1
+	for i, r := range qs {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if start > -1 {
+				terms = append(terms, qs[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start == -1 {
+			start = i
+		}
+	}
+	if start > -1 {
+		terms = append(terms, qs[start:])
+	}
+	return terms
+}
+
+// advancedQuery returns the query for a query string in the Advanced mode,
+// and whether it has anything to rank documents by besides date filters.
+// Date filters, which may be prefixed with + or - like any other term, are
+// taken out of the query string since bleve only compares dates that are
+// quoted and complete.
+func advancedQuery(qs string) (query.Query, bool, error) {
+	var rest []string
+	bq := bleve.NewBooleanQuery()
+	for _, t := range splitTerms(qs) {
+		field := strings.TrimLeft(t, "+-")
+		i := strings.Index(field, ":")
+		if i < 1 || (field[:i] != CreatedField && field[:i] != UpdatedField) {
+			rest = append(rest, t)
+			continue
+		}
+
+		q, err := dateFilter(field[:i], strings.Trim(field[i+1:], `"`))
+		if err != nil {
+			return nil, false, err
+		}
+		if strings.HasPrefix(t, "-") {
+			bq.AddMustNot(q)
+		} else {
+			bq.AddMust(q)
+		}
+	}
+
+	if len(rest) > 0 {
+		q := bleve.NewQueryStringQuery(strings.Join(rest, " "))
+		if _, err := q.Parse(); err != nil {
+			return nil, false, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+		bq.AddMust(q)
+	}
+	if bq.Must == nil && bq.MustNot == nil {
+		return bleve.NewMatchAllQuery(), false, nil
+	}
+	return bq, len(rest) > 0, nil
+}
@@ -0,0 +1,126 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitTerms(t *testing.T) {
+	tests := []struct {
+		qs   string
+		want []string
+	}{
+		{"", nil},
+		{"  ", nil},
+		{"hello world", []string{"hello", "world"}},
+		{"  hello \t world ", []string{"hello", "world"}},
+		{`source:"hacker news" go`, []string{`source:"hacker news"`, "go"}},
+		{`"exact phrase"`, []string{`"exact phrase"`}},
+		{`"unterminated phrase`, []string{`"unterminated phrase`}},
+	}
+	for _, tt := range tests {
+		if got := splitTerms(tt.qs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitTerms(%q) = %q, want %q", tt.qs, got, tt.want)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	s := newTestIndex(t, map[string]Document{
+		"go":   {Content: "goroutines and channels", Tags: []string{"golang"}, Meta: map[string]string{"source": "hacker news"}},
+		"rust": {Content: "ownership and channels", Tags: []string{"rust"}, Meta: map[string]string{"source": "lobsters"}},
+		"note": {Content: "kind:draft notes about tag:"},
+	})
+	defer s.Close()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"tag:golang", "go"},
+		{"tag:#Golang", "go"},
+		{"tag:python", ""},
+		{`source:"hacker news"`, "go"},
+		{"source:lobsters channels", "rust"},
+		{"channels tag:rust", "rust"},
+		{"channels", "go rust"},
+		// Keys that aren't fields are searched for like any other term.
+		{"kind:draft", "note"},
+		{"tag:", "note"},
+		{"", "go note rust"},
+	}
+	for _, tt := range tests {
+		ids, err := queryIDs(t, s, tt.query, Keyword)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("%s matched %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestAdvancedQuery(t *testing.T) {
+	s := newTestIndex(t, map[string]Document{
+		"go":   {Content: "goroutines and channels", Created: day("2022-01-01T12:00"), Meta: map[string]string{"source": "hacker news"}},
+		"rust": {Content: "ownership and channels", Created: day("2022-02-01T12:00")},
+		"zig":  {Content: "comptime", Created: day("2022-03-01T12:00")},
+	})
+	defer s.Close()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"+channels -ownership", "go"},
+		{`"and channels"`, "go rust"},
+		{"source:hacker", "go"},
+		{"ownershp~1", "rust"},
+		{"gorout*", "go"},
+		{"created:>2022-01-15", "rust zig"},
+		{"+channels created:2022-02", "rust"},
+		{"-created:2022-01", "rust zig"},
+		{"", "go rust zig"},
+	}
+	for _, tt := range tests {
+		ids, err := queryIDs(t, s, tt.query, Advanced)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("%s matched %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	for _, qs := range []string{`"unterminated`, "channels~x", "+"} {
+		if _, err := queryIDs(t, s, qs, Advanced); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s = %v, want ErrInvalidQuery", qs, err)
+		}
+	}
+	if _, err := queryIDs(t, s, "created:soon", Advanced); !errors.Is(err, ErrInvalidDate) {
+		t.Errorf("created:soon = %v, want ErrInvalidDate", err)
+	}
+}
+
+func TestAdvancedQueryRanked(t *testing.T) {
+	for qs, want := range map[string]bool{
+		"":                          false,
+		"created:2022":              false,
+		"-updated:<2022-01-01":      false,
+		"hello":                     true,
+		"hello created:>2022-01-01": true,
+	} {
+		_, ranked, err := advancedQuery(qs)
+		if err != nil {
+			t.Errorf("advancedQuery(%q): %v", qs, err)
+			continue
+		}
+		if ranked != want {
+			t.Errorf("advancedQuery(%q) ranked = %v, want %v", qs, ranked, want)
+		}
+	}
+}
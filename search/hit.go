@@ -0,0 +1,58 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+// How the html highlighter marks the terms that matched in a fragment.
+const (
+	markStart = "<mark>"
+	markEnd   = "</mark>"
+)
+
+// A Hit is a document that matched a query.
+type Hit struct {
+	ID string
+
+	// Score is how well the document matched, the higher the better.
+	Score float64
+
+	// Fragments are the parts of the document's content, then of its
+	// attachments, where the query matched.
+	Fragments []Fragment
+}
+
+// A Fragment is a part of a document where a query matched.
+type Fragment struct {
+	Text string
+
+	// Matches are where the terms that matched are in Text, as the byte
+	// offsets of their start and end.
+	Matches [][2]int
+}
+
+// parseFragment turns a fragment formatted by the html highlighter back
+// into plain text, noting where the marked terms were.
+func parseFragment(s string) Fragment {
+	var f Fragment
+	var text strings.Builder
+	for {
+		i := strings.Index(s, markStart)
+		if i == -1 {
+			break
+		}
+		j := strings.Index(s[i:], markEnd)
+		if j == -1 {
+			break
+		}
+		text.WriteString(html.UnescapeString(s[:i]))
+		start := text.Len()
+		text.WriteString(html.UnescapeString(s[i+len(markStart) : i+j]))
+		f.Matches = append(f.Matches, [2]int{start, text.Len()})
+		s = s[i+j+len(markEnd):]
+	}
+	text.WriteString(html.UnescapeString(s))
+	f.Text = text.String()
+	return f
+}
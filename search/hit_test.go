@@ -0,0 +1,49 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFragment(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Fragment
+	}{
+		{"no matches", Fragment{Text: "no matches"}},
+		{"<mark>hello</mark> world", Fragment{Text: "hello world", Matches: [][2]int{{0, 5}}}},
+		{"a <mark>b</mark> c <mark>d</mark>", Fragment{Text: "a b c d", Matches: [][2]int{{2, 3}, {6, 7}}}},
+		{"&lt;p&gt; <mark>fish &amp; chips</mark>", Fragment{Text: "<p> fish & chips", Matches: [][2]int{{4, 16}}}},
+		{"<mark>unterminated", Fragment{Text: "<mark>unterminated"}},
+	}
+	for _, tt := range tests {
+		if got := parseFragment(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFragment(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestQueryFragments(t *testing.T) {
+	s := newTestIndex(t, map[string]Document{
+		"cell": {Content: "the quick brown fox", Attachments: []string{"a fox in a PDF"}},
+	})
+	defer s.Close()
+
+	res, err := s.Query(Request{Query: "fox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 || res.Hits[0].Score <= 0 {
+		t.Fatalf("hits = %+v, want one scored hit", res.Hits)
+	}
+	frags := res.Hits[0].Fragments
+	if len(frags) != 2 {
+		t.Fatalf("fragments = %+v, want the content's then the attachment's", frags)
+	}
+	for i, text := range []string{"the quick brown fox", "a fox in a PDF"} {
+		f := frags[i]
+		if f.Text != text || len(f.Matches) != 1 || f.Text[f.Matches[0][0]:f.Matches[0][1]] != "fox" {
+			t.Errorf("fragment %d = %+v, want %q with fox marked", i, f, text)
+		}
+	}
+}
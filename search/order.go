@@ -0,0 +1,65 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Order is the order Query returns hits in.
+type Order uint8
+
+const (
+	// Relevance lists the documents that match best first.
+	Relevance Order = iota
+
+	// Newest lists the documents whose cells were written most recently
+	// first, and Oldest those written least recently.
+	Newest
+	Oldest
+
+	// RecentlyUpdated lists the documents that changed most recently first.
+	RecentlyUpdated
+
+	// RecentlyViewed lists the documents viewed most recently first, see
+	// Batch.SetViewed, followed by those that were never viewed, most
+	// recently changed first.
+	RecentlyViewed
+)
+
+// The names of each order, as ParseOrder reads them.
+var orderNames = []string{"relevance", "newest", "oldest", "updated", "viewed"}
+
+// ParseOrder returns the order with the given name, one of relevance,
+// newest, oldest, updated and viewed.
+func ParseOrder(s string) (Order, error) {
+	for i, name := range orderNames {
+		if strings.EqualFold(s, name) {
+			return Order(i), nil
+		}
+	}
+	return Relevance, fmt.Errorf("unknown order %q, expected one of %s", s, strings.Join(orderNames, ", "))
+}
+
+func (o Order) String() string {
+	if int(o) < len(orderNames) {
+		return orderNames[o]
+	}
+	return fmt.Sprintf("Order(%d)", o)
+}
+
+// sortBy returns what bleve sorts hits by for the order, or nil for the
+// order of their scores. Documents that compare the same on every field
+// are sorted by their ids, so that pages don't overlap.
+func (o Order) sortBy() []string {
+	switch o {
+	case Newest:
+		return []string{"-" + CreatedField, "-" + UpdatedField, "_id"}
+	case Oldest:
+		return []string{CreatedField, UpdatedField, "_id"}
+	case RecentlyUpdated:
+		return []string{"-" + UpdatedField, "_id"}
+	case RecentlyViewed:
+		return []string{"-" + ViewedField, "-" + UpdatedField, "_id"}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+// queryOrder returns the ids of the documents that match a query, in the
+// order of the hits.
+func queryOrder(t *testing.T, s *Search, qs string, order Order) string {
+	t.Helper()
+
+	res, err := s.Query(Request{Query: qs, Order: order})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(res.Hits))
+	for i, h := range res.Hits {
+		ids[i] = h.ID
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestParseOrder(t *testing.T) {
+	for i, name := range []string{"relevance", "Newest", "OLDEST", "updated", "viewed"} {
+		o, err := ParseOrder(name)
+		if err != nil || o != Order(i) {
+			t.Errorf("ParseOrder(%q) = %v, %v, want %v", name, o, err, Order(i))
+		}
+		if !strings.EqualFold(o.String(), name) {
+			t.Errorf("%v.String() = %q, want %q", o, o.String(), strings.ToLower(name))
+		}
+	}
+	if _, err := ParseOrder("random"); err == nil {
+		t.Error("ParseOrder(\"random\") didn't fail")
+	}
+}
+
+func TestOrders(t *testing.T) {
+	s, err := NewMemOnly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Viewed times are indexed along with the documents in the batch.
+	batch := s.NewBatch()
+	batch.SetViewed("b", day("2022-04-01T12:00"))
+	batch.SetViewed("c", day("2022-04-02T12:00"))
+	docs := map[string]Document{
+		"a": {Content: "fox", Created: day("2022-01-01T12:00"), Updated: day("2022-03-01T12:00")},
+		"b": {Content: "fox fox fox", Created: day("2022-01-02T12:00"), Updated: day("2022-01-02T12:00")},
+		"c": {Content: "fox and many other words", Created: day("2022-02-01T12:00"), Updated: day("2022-02-01T12:00")},
+	}
+	for id, doc := range docs {
+		if err := batch.Index(id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		order Order
+		want  string
+	}{
+		{Relevance, "b a c"},
+		{Newest, "c b a"},
+		{Oldest, "a b c"},
+		{RecentlyUpdated, "a c b"},
+		{RecentlyViewed, "c b a"},
+	}
+	for _, tt := range tests {
+		if got := queryOrder(t, s, "fox", tt.order); got != tt.want {
+			t.Errorf("%v order = %q, want %q", tt.order, got, tt.want)
+		}
+	}
+}
@@ -1,13 +1,23 @@
 package search
 
 import (
+	"errors"
+	"os"
 	"path"
+	"strings"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
 	"github.com/blevesearch/bleve/v2/search/query"
 )
 
-const indexFn = ".index.bleve"
+const (
+	indexFn = ".index.bleve"
+
+	// DefaultPageSize is how many hits Query returns for a request that
+	// doesn't say.
+	DefaultPageSize = 100
+)
 
 // Mode is an enum that defines the type of search to run against the index.
 type Mode uint8
@@ -17,11 +27,41 @@ const (
 	Phrase
 	Fuzzy
 	Wildcard
+
+	// Advanced parses bleve's query string syntax, as in +must -not
+	// "exact phrase" field:value term~2, see Query.
+	Advanced
 )
 
+// A Request is a query along with which of its hits to return.
+type Request struct {
+	Query string
+	Mode  Mode
+
+	// Offset is how many hits to skip, and Size how many to return after
+	// them, which is DefaultPageSize if it's 0.
+	Offset int
+	Size   int
+
+	// Order is the order of the hits, which is Relevance unless given.
+	Order Order
+}
+
+// A Result is a page of the hits for a request, in the order it asks for.
+type Result struct {
+	Hits []Hit
+
+	// Total is how many hits there are across every page.
+	Total uint64
+}
+
 // Search is responsible for creating and operating a bleve index.
 type Search struct {
+	path  string
 	index bleve.Index
+
+	// When each document was last viewed, see Batch.SetViewed.
+	viewed map[string]int64
 }
 
 // New initialises Search with an open index ready for querying.
@@ -29,30 +69,260 @@ type Search struct {
 // If it's the first time this has been called it will initialise
 // a new folder for the index under the given directory.
 func New(dir string) (*Search, error) {
-	index, err := openIndexOrInit(dir)
+	fullPath := path.Join(dir, indexFn)
+	index, err := openIndexOrInit(fullPath)
 	if err != nil {
 		return nil, err
 	}
-	return &Search{index: index}, nil
+	viewed, err := readViewed(index)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	return &Search{path: fullPath, index: index, viewed: viewed}, nil
 }
 
-// Index indexes the data for a given id.
-//
-// The identifier we use here is a combination of the byte offset
-// and size of the data in bytes which we can use to quickly read the
-// data from disk.
-func (s *Search) Index(id string, data string) error {
-	return s.index.Index(id, data)
+// NewMemOnly initialises Search with an empty index that is only kept in
+// memory.
+func NewMemOnly() (*Search, error) {
+	index, err := newMemOnly()
+	if err != nil {
+		return nil, err
+	}
+	return &Search{index: index, viewed: make(map[string]int64)}, nil
+}
+
+// Exists reports whether there is an index under the given directory.
+func Exists(dir string) bool {
+	_, err := os.Stat(path.Join(dir, indexFn))
+	return err == nil
+}
+
+// Remove deletes the index under the given directory.
+func Remove(dir string) error {
+	return os.RemoveAll(path.Join(dir, indexFn))
+}
+
+// Reset throws away every document in the index, leaving it empty. When
+// documents were last viewed is kept, to be indexed along with them when
+// they are indexed again.
+func (s *Search) Reset() error {
+	if err := s.index.Close(); err != nil {
+		return err
+	}
+
+	var index bleve.Index
+	var err error
+	if s.path == "" {
+		index, err = newMemOnly()
+	} else if err = os.RemoveAll(s.path); err == nil {
+		index, err = openIndexOrInit(s.path)
+	}
+	if err != nil {
+		return err
+	}
+	s.index = index
+
+	if len(s.viewed) == 0 {
+		return nil
+	}
+	buf, err := s.encodeViewed()
+	if err != nil {
+		return err
+	}
+	return index.SetInternal([]byte(viewedKey), buf)
+}
+
+// Index indexes the document for a given id.
+func (s *Search) Index(id string, doc Document) error {
+	fields := doc.fields()
+	s.addViewed(id, fields)
+	return s.index.Index(id, fields)
 }
 
 // Delete removes a document from the index by its ID.
 func (s *Search) Delete(id string) error {
-	return s.index.Delete(id)
+	if !s.forgetViewed(id) {
+		return s.index.Delete(id)
+	}
+	b := s.NewBatch()
+	b.Delete(id)
+	b.viewedChanged = true
+	return b.Commit()
+}
+
+// IDs returns the ids of every document in the index.
+func (s *Search) IDs() ([]string, error) {
+	n, err := s.index.DocCount()
+	if err != nil {
+		return nil, err
+	}
+
+	r := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	r.Size = int(n)
+
+	res, err := s.index.Search(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(res.Hits))
+	for i, h := range res.Hits {
+		ids[i] = h.ID
+	}
+
+	return ids, nil
+}
+
+// Contains reports whether there's a document with the given id in the
+// index.
+func (s *Search) Contains(id string) (bool, error) {
+	doc, err := s.index.Document(id)
+	if err != nil {
+		return false, err
+	}
+	return doc != nil, nil
+}
+
+// WithTerms returns the ids of every document that has any of the given
+// terms in a field whose values are indexed whole, such as LinkField.
+func (s *Search) WithTerms(field string, terms []string) ([]string, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	qs := make([]query.Query, len(terms))
+	for i, t := range terms {
+		tq := bleve.NewTermQuery(t)
+		tq.SetField(field)
+		qs[i] = tq
+	}
+
+	n, err := s.index.DocCount()
+	if err != nil {
+		return nil, err
+	}
+	r := bleve.NewSearchRequest(bleve.NewDisjunctionQuery(qs...))
+	r.Size = int(n)
+
+	res, err := s.index.Search(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(res.Hits))
+	for i, h := range res.Hits {
+		ids[i] = h.ID
+	}
+	return ids, nil
+}
+
+// Internal returns the value stored under key in the index's internal
+// key/value store, or nil if there is none.
+func (s *Search) Internal(key string) ([]byte, error) {
+	return s.index.GetInternal([]byte(key))
+}
+
+// DeleteInternal removes key from the index's internal key/value store.
+func (s *Search) DeleteInternal(key string) error {
+	return s.index.DeleteInternal([]byte(key))
+}
+
+// CopyTo writes a consistent copy of the index to the given directory, in
+// the same place within it that New keeps the index, while the index stays
+// open. An index that is only kept in memory has nothing to copy, so
+// CopyTo does nothing.
+func (s *Search) CopyTo(dir string) error {
+	if s.path == "" {
+		return nil
+	}
+	c, ok := s.index.(bleve.IndexCopyable)
+	if !ok {
+		return errors.New("index can't be copied")
+	}
+	return c.CopyTo(bleve.FileSystemDirectory(path.Join(dir, indexFn)))
+}
+
+// Close closes the underlying index.
+func (s *Search) Close() error {
+	return s.index.Close()
+}
+
+// Query runs a match query on the index and returns the page of document
+// ids that the request asks for, along with how many matches there are.
+//
+// Terms of the form key:value, where key is a metadata key that has been
+// indexed, only match documents with that value for the key, whatever the
+// mode. So do terms such as created:>2022-01-01 and updated:2022-03, which
+// compare dates instead.
+//
+// In the Advanced mode, the query is only split into its date filters and
+// the rest, which is left to bleve. Queries bleve can't parse fail with
+// ErrInvalidQuery.
+//
+// An empty query matches every document, and a query of only filters every
+// document they let through. Since there's nothing to rank those by, they
+// are listed newest first rather than by relevance.
+func (s *Search) Query(req Request) (*Result, error) {
+	q, ranked, err := s.parse(req.Query, req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	order := req.Order
+	if order == Relevance && !ranked {
+		order = Newest
+	}
+
+	size := req.Size
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	r := bleve.NewSearchRequestOptions(q, size, req.Offset, false)
+	if by := order.sortBy(); by != nil {
+		r.SortBy(by)
+	}
+	r.Highlight = bleve.NewHighlightWithStyle(html.Name)
+	r.Highlight.Fields = []string{ContentField, AttachmentField}
+
+	res, err := s.index.Search(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, len(res.Hits))
+	for i, h := range res.Hits {
+		hits[i] = Hit{ID: h.ID, Score: h.Score}
+		for _, f := range r.Highlight.Fields {
+			for _, frag := range h.Fragments[f] {
+				// Fields that didn't match are given a fragment all the
+				// same, from their start.
+				if frag := parseFragment(frag); len(frag.Matches) > 0 {
+					hits[i].Fragments = append(hits[i].Fragments, frag)
+				}
+			}
+		}
+	}
+	return &Result{Hits: hits, Total: res.Total}, nil
 }
 
-// Query runs a match query on the index and returns the document
-// ids if there are any matches
-func (s *Search) Query(qs string, mode Mode) ([]string, error) {
+// parse returns the query for a query string in the given mode, and
+// whether it has anything to rank documents by besides filters.
+func (s *Search) parse(qs string, mode Mode) (query.Query, bool, error) {
+	if mode == Advanced {
+		return advancedQuery(qs)
+	}
+
+	qs, filters, err := s.splitFilters(qs)
+	if err != nil {
+		return nil, false, err
+	}
+	if qs = strings.TrimSpace(qs); qs == "" {
+		if len(filters) == 0 {
+			return bleve.NewMatchAllQuery(), false, nil
+		}
+		return bleve.NewConjunctionQuery(filters...), false, nil
+	}
+
 	var q query.Query
 	switch mode {
 	case Keyword:
@@ -66,32 +336,67 @@ func (s *Search) Query(qs string, mode Mode) ([]string, error) {
 	default:
 		q = bleve.NewMatchQuery(qs)
 	}
+	if len(filters) > 0 {
+		q = bleve.NewConjunctionQuery(append(filters, q)...)
+	}
+	return q, true, nil
+}
 
-	r := bleve.NewSearchRequest(q)
+// A Batch groups index operations so that they can be applied to the
+// index atomically.
+type Batch struct {
+	s     *Search
+	batch *bleve.Batch
 
-	// How many do we want to return in a single request?
-	r.Size = 100
+	// Whether when documents were last viewed has changed, and needs to
+	// be written along with the batch.
+	viewedChanged bool
+}
 
-	res, err := s.index.Search(r)
-	if err != nil {
-		return nil, err
-	}
+// NewBatch returns an empty batch for the index.
+func (s *Search) NewBatch() *Batch {
+	return &Batch{s: s, batch: s.index.NewBatch()}
+}
 
-	if res == nil || len(res.Hits) == 0 {
-		return nil, nil
-	}
+// Index adds an index operation for the document of a given id to the
+// batch.
+func (b *Batch) Index(id string, doc Document) error {
+	fields := doc.fields()
+	b.s.addViewed(id, fields)
+	return b.batch.Index(id, fields)
+}
 
-	ids := make([]string, len(res.Hits))
-	for i, h := range res.Hits {
-		ids[i] = h.ID
+// Delete adds a delete operation for a given id to the batch.
+func (b *Batch) Delete(id string) {
+	b.batch.Delete(id)
+	if b.s.forgetViewed(id) {
+		b.viewedChanged = true
 	}
+}
 
-	return ids, nil
+// SetInternal adds a write to the index's internal key/value store to the batch.
+func (b *Batch) SetInternal(key string, val []byte) {
+	b.batch.SetInternal([]byte(key), val)
 }
 
-func openIndexOrInit(dir string) (bleve.Index, error) {
-	fullPath := path.Join(dir, indexFn)
+// Size returns the number of operations in the batch.
+func (b *Batch) Size() int {
+	return b.batch.Size()
+}
+
+// Commit applies every operation in the batch to the index.
+func (b *Batch) Commit() error {
+	if b.viewedChanged {
+		buf, err := b.s.encodeViewed()
+		if err != nil {
+			return err
+		}
+		b.batch.SetInternal([]byte(viewedKey), buf)
+	}
+	return b.s.index.Batch(b.batch)
+}
 
+func openIndexOrInit(fullPath string) (bleve.Index, error) {
 	index, err := bleve.Open(fullPath)
 	if err != nil {
 		if err != bleve.ErrorIndexPathDoesNotExist {
@@ -99,11 +404,23 @@ func openIndexOrInit(dir string) (bleve.Index, error) {
 		}
 
 		// Initialise a new index with default mappings.
-		return bleve.New(
+		index, err := bleve.New(
 			fullPath,
-			bleve.NewIndexMapping(),
+			newMapping(),
 		)
+		if err != nil {
+			return nil, err
+		}
+		return index, setVersion(index)
 	}
 
 	return index, nil
 }
+
+func newMemOnly() (bleve.Index, error) {
+	index, err := bleve.NewMemOnly(newMapping())
+	if err != nil {
+		return nil, err
+	}
+	return index, setVersion(index)
+}
@@ -0,0 +1,33 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestQueryBrowsesEverything(t *testing.T) {
+	docs := make(map[string]Document)
+	for i := 1; i <= 9; i++ {
+		docs[fmt.Sprint(i)] = Document{Content: "cell", Created: day(fmt.Sprintf("2022-01-0%dT12:00", i))}
+	}
+	s := newTestIndex(t, docs)
+	defer s.Close()
+
+	// With nothing to rank by, every document is listed newest first.
+	for _, qs := range []string{"", "  ", "created:2022"} {
+		if got := queryOrder(t, s, qs, Relevance); got != "9 8 7 6 5 4 3 2 1" {
+			t.Errorf("%q listed %q, want every document newest first", qs, got)
+		}
+	}
+	if got := queryOrder(t, s, "", Oldest); got != "1 2 3 4 5 6 7 8 9" {
+		t.Errorf("empty query oldest first listed %q", got)
+	}
+
+	res, err := s.Query(Request{Offset: 4, Size: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 9 || len(res.Hits) != 3 || res.Hits[0].ID != "5" {
+		t.Errorf("second page = %d hits of %d from %+v, want 3 of 9 from 5", len(res.Hits), res.Total, res.Hits)
+	}
+}
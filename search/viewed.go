@@ -0,0 +1,94 @@
+package search
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+const (
+	// ViewedField is the field when a document was last viewed is indexed
+	// under, see Batch.SetViewed.
+	ViewedField = "viewed"
+
+	// viewedKey is where when each document was last viewed is kept in
+	// the index's internal key/value store, as a JSON object of their
+	// UnixNano times by id.
+	viewedKey = "viewed"
+)
+
+// LastViewed returns when the document with the given id was last viewed,
+// or the zero time if it never was.
+func (s *Search) LastViewed(id string) time.Time {
+	if ns, ok := s.viewed[id]; ok {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// SetViewed adds a write of when the document with the given id was last
+// viewed to the batch. It is indexed along with the document from then
+// on, so it's only searchable once the document is indexed again, which
+// it should be in the same batch.
+//
+// Deleting the document forgets when it was viewed, while Reset keeps it
+// for the documents indexed afterwards.
+func (b *Batch) SetViewed(id string, t time.Time) {
+	b.s.viewed[id] = t.UnixNano()
+	b.viewedChanged = true
+}
+
+// Unindex removes a document from the index like Delete, but keeps when
+// it was last viewed to be indexed along with it should it be indexed
+// again, such as a cell that is restored from the trash. ForgetViewed
+// forgets it once it won't be.
+func (s *Search) Unindex(id string) error {
+	return s.index.Delete(id)
+}
+
+// ForgetViewed forgets when a document that was unindexed was last
+// viewed, see Unindex.
+func (s *Search) ForgetViewed(id string) error {
+	if !s.forgetViewed(id) {
+		return nil
+	}
+	b := s.NewBatch()
+	b.viewedChanged = true
+	return b.Commit()
+}
+
+// addViewed adds when the document was last viewed, if it ever was, to the
+// fields that are indexed for it.
+func (s *Search) addViewed(id string, fields map[string]interface{}) {
+	if ns, ok := s.viewed[id]; ok {
+		fields[ViewedField] = time.Unix(0, ns)
+	}
+}
+
+// forgetViewed removes when the document was last viewed, returning
+// whether it ever was.
+func (s *Search) forgetViewed(id string) bool {
+	if _, ok := s.viewed[id]; !ok {
+		return false
+	}
+	delete(s.viewed, id)
+	return true
+}
+
+func (s *Search) encodeViewed() ([]byte, error) {
+	return json.Marshal(s.viewed)
+}
+
+func readViewed(index bleve.Index) (map[string]int64, error) {
+	viewed := make(map[string]int64)
+	buf, err := index.GetInternal([]byte(viewedKey))
+	if err != nil || buf == nil {
+		return viewed, err
+	}
+	if err := json.Unmarshal(buf, &viewed); err != nil {
+		// Forgetting when cells were viewed only changes their order.
+		return make(map[string]int64), nil
+	}
+	return viewed, nil
+}
@@ -0,0 +1,78 @@
+package brain
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/sno6/brain/search"
+)
+
+// openSnapshot opens a brain for reading without its lock, see ReadOnly.
+//
+// The process holding the lock may append to .data and .offsets at any
+// time, and keeps the index locked, so the offset table and index are
+// both rebuilt in memory by replaying .data up to its current size.
+// Compaction replaces .data rather than rewriting it, so the file we
+// have open stays intact even if the writer compacts it.
+func (b *Brain) openSnapshot() error {
+	data, err := os.Open(path.Join(b.dir, dataFn))
+	if err != nil {
+		return err
+	}
+	fs := &fileStore{dir: b.dir, data: data, table: newTable(nil)}
+	if fs.key, err = loadKey(b.dir, b.passphrase); err != nil {
+		data.Close()
+		return err
+	}
+	b.passphrase = ""
+	b.store, b.fs = fs, fs
+	if b.search, err = search.NewMemOnly(); err != nil {
+		data.Close()
+		return err
+	}
+
+	sz, err := size(data)
+	if err != nil {
+		b.Close()
+		return err
+	}
+	if sz == 0 {
+		return nil
+	}
+
+	version, err := readVersion(data)
+	if err == nil && version != formatVersion {
+		err = fmt.Errorf("brain must be migrated before it can be read, open it for writing first")
+	}
+	if err != nil {
+		b.Close()
+		return err
+	}
+
+	report := &Report{}
+	cells, err := fs.replay(report)
+	if err != nil {
+		b.Close()
+		return err
+	}
+	fs.snapshotSize = sz
+	if report.TruncatedAt != 0 {
+		// The writer is part way through appending a record.
+		fs.snapshotSize = report.TruncatedAt
+	}
+	for id, rc := range cells {
+		fs.table.locations[id] = rc.loc
+		if rc.cell.legacyID != "" {
+			fs.table.aliases[rc.cell.legacyID] = id
+		}
+		if rc.cell.trashed != 0 {
+			fs.table.trash[id] = rc.cell.trashed
+		}
+	}
+	if _, err := b.indexCells(cells); err != nil {
+		b.Close()
+		return err
+	}
+	return nil
+}
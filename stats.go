@@ -0,0 +1,122 @@
+package brain
+
+import "errors"
+
+// Stats describes what a brain's .data file holds.
+type Stats struct {
+	// Cells is the number of cells, including those in the trash.
+	Cells int
+
+	// Trashed is the number of cells in the trash.
+	Trashed int
+
+	// Revisions is the number of earlier revisions of edited cells that
+	// are kept for their history.
+	Revisions int
+
+	// Records is the number of records in .data, and Compressed how many
+	// of them are compressed.
+	Records    int
+	Compressed int
+
+	// Size is the size of .data in bytes.
+	Size int64
+
+	// Stored is the number of bytes taken up by record payloads in .data,
+	// and Raw the number they would take up if they were neither
+	// compressed nor sealed.
+	Stored int64
+	Raw    int64
+}
+
+// CompressionRatio returns how many times smaller record payloads are in
+// .data than they would be stored raw.
+func (s *Stats) CompressionRatio() float64 {
+	if s.Stored == 0 {
+		return 1
+	}
+	return float64(s.Raw) / float64(s.Stored)
+}
+
+// Stats walks .data and reports what it holds. Records that can't be
+// read are skipped, see Verify to find them. It returns ErrNotSupported
+// for a brain that doesn't keep its cells in .data.
+func (b *Brain) Stats() (*Stats, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	fs, err := b.file()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+	if stats.Size, err = size(fs.data); err != nil {
+		return nil, err
+	}
+
+	cells, err := fs.replay(&Report{})
+	if err != nil {
+		return nil, err
+	}
+	for _, rc := range cells {
+		switch {
+		case !rc.live:
+			stats.Revisions++
+		case rc.cell.trashed != 0:
+			stats.Trashed++
+			stats.Cells++
+		default:
+			stats.Cells++
+		}
+	}
+
+	enc := fs.codec()
+	scanner := newRecordScanner(fs.data, stats.Size)
+	for {
+		if !scanner.next() {
+			offset, err := scanner.failedAt()
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, ErrCorruptRecord) {
+				return nil, err
+			}
+			next, ok, err := nextRecord(fs.data, offset, stats.Size)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			scanner.seek(next)
+			continue
+		}
+
+		offset, rec := scanner.record()
+		flags, payload, err := unframe(rec)
+		var raw []byte
+		if err == nil {
+			raw, err = enc.decode(flags, payload)
+		}
+		if err != nil {
+			next, ok, err := nextRecord(fs.data, offset, stats.Size)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				scanner.seek(next)
+			}
+			continue
+		}
+
+		stats.Records++
+		if flags&flagCompressed != 0 {
+			stats.Compressed++
+		}
+		stats.Stored += int64(len(payload))
+		stats.Raw += int64(len(raw))
+	}
+
+	return stats, nil
+}
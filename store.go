@@ -0,0 +1,100 @@
+package brain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sno6/brain/search"
+)
+
+var (
+	// ErrUnknownCell is returned when reading a cell that isn't in the
+	// store.
+	ErrUnknownCell = errors.New("unknown cell identifier")
+
+	// ErrNotSupported is returned by operations that only make sense for
+	// a brain that keeps its cells in .data, such as compaction, when it
+	// was opened with another store.
+	ErrNotSupported = errors.New("not supported by this store")
+)
+
+// A Store is where a Brain keeps its cells. Open keeps them in the .data
+// file, see OpenStore to use another store.
+//
+// Stores keep the state of the cells they are given, see Cell.State, and
+// return cells made from it with RestoreCell.
+//
+// Stores are only used through a Brain, which never calls their methods
+// that change the store concurrently with any other method.
+type Store interface {
+	// Append stores a new cell, or a new revision of a cell when its
+	// Previous is set, in which case the earlier revision is kept too.
+	Append(c *Cell) error
+
+	// Read returns the cell with the given identifier, with its Trashed
+	// state set to when SetTrashed last moved it to the trash, if it is
+	// there. It returns an error wrapping ErrUnknownCell if there is no
+	// such cell.
+	Read(id string) (*Cell, error)
+
+	// Iterate calls fn with every stored cell, including earlier
+	// revisions and cells in the trash, in the order they were appended.
+	// It stops at the first error fn returns.
+	Iterate(fn func(*Cell) error) error
+
+	// Delete forgets a cell for good.
+	Delete(id string) error
+
+	// SetTrashed records that a cell was moved to the trash at ts, a unix
+	// timestamp, or taken back out of it if ts is 0.
+	SetTrashed(id string, ts int64) error
+
+	// Trashed returns when each cell in the trash was moved there.
+	Trashed() (map[string]int64, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// OpenStore initialises a Brain that keeps its cells in the given store.
+// Its index is only kept in memory, and is built from the store's cells
+// as it is opened.
+//
+// The store's cells can't be encrypted, so WithPassphrase makes it fail
+// with an error wrapping ErrNotSupported, and WithCompression has no
+// effect.
+func OpenStore(s Store, opts ...Option) (*Brain, error) {
+	b := &Brain{
+		store:     s,
+		retention: DefaultTrashRetention,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.passphrase != "" {
+		return nil, fmt.Errorf("%w: the store can't be encrypted", ErrNotSupported)
+	}
+
+	var err error
+	if b.search, err = search.NewMemOnly(); err != nil {
+		return nil, err
+	}
+	if _, err := b.reindex(); err != nil {
+		return nil, err
+	}
+	if b.readOnly {
+		return b, nil
+	}
+	if _, err := b.purgeExpired(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// file returns the store of a brain that keeps its cells in .data.
+func (b *Brain) file() (*fileStore, error) {
+	if b.fs == nil {
+		return nil, ErrNotSupported
+	}
+	return b.fs, nil
+}
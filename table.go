@@ -0,0 +1,199 @@
+package brain
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	tableFn = ".offsets"
+
+	// Markers for table entries that change the state of a cell.
+	removed  = "-"
+	trashed  = "trash"
+	restored = "restore"
+)
+
+// A location is where a cell's record lives in .data.
+type location struct {
+	offset, size int64
+}
+
+// An offsetTable maps stable cell identifiers to the location of their
+// record in .data, so that the data file layout can change without
+// invalidating identifiers.
+//
+// It also keeps track of which cells are in the trash, and since when.
+//
+// On disk it is an append-only text file alongside .data where each line
+// is "<id> <offset> <size>", optionally followed by the legacy offset:size
+// identifier the cell was known by before it was migrated. A cell that has
+// been moved to the trash has a "<id> trash <unix ts>" line, which a
+// "<id> restore" line undoes, and "<id> -" forgets a cell once it has
+// been purged. Later lines override earlier ones.
+type offsetTable struct {
+	f         *os.File
+	locations map[string]location
+	aliases   map[string]string
+	trash     map[string]int64
+}
+
+// openTable opens, or creates, the offset table in the given directory.
+func openTable(dir string) (*offsetTable, error) {
+	f, err := os.OpenFile(path.Join(dir, tableFn), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	t := newTable(f)
+	if err := t.load(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// newTable returns an empty offset table that appends its entries to f.
+// A table without a file is only kept in memory and can't be changed.
+func newTable(f *os.File) *offsetTable {
+	return &offsetTable{
+		f:         f,
+		locations: make(map[string]location),
+		aliases:   make(map[string]string),
+		trash:     make(map[string]int64),
+	}
+}
+
+func (t *offsetTable) load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		id := fields[0]
+		switch fields[1] {
+		case removed:
+			delete(t.locations, id)
+			delete(t.trash, id)
+			continue
+		case trashed:
+			if len(fields) < 3 {
+				continue
+			}
+			ts, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid offset table entry: %w", err)
+			}
+			t.trash[id] = ts
+			continue
+		case restored:
+			delete(t.trash, id)
+			continue
+		}
+		if len(fields) < 3 {
+			continue
+		}
+
+		offset, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid offset table entry: %w", err)
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid offset table entry: %w", err)
+		}
+
+		t.locations[id] = location{offset: offset, size: size}
+		if len(fields) > 3 {
+			t.aliases[fields[3]] = id
+		}
+	}
+	return scanner.Err()
+}
+
+// lookup returns the location of the cell with the given stable identifier.
+func (t *offsetTable) lookup(id string) (location, bool) {
+	loc, ok := t.locations[id]
+	return loc, ok
+}
+
+// resolve maps a migrated legacy identifier to its stable identifier.
+// Any other identifier is returned unchanged.
+func (t *offsetTable) resolve(id string) string {
+	if stable, ok := t.aliases[id]; ok {
+		return stable
+	}
+	return id
+}
+
+// add records the location of a cell.
+func (t *offsetTable) add(id string, loc location) error {
+	if _, err := writeTableEntry(t.f, id, loc, ""); err != nil {
+		return err
+	}
+	t.locations[id] = loc
+	return nil
+}
+
+// remove forgets the location of a purged cell.
+func (t *offsetTable) remove(id string) error {
+	if _, ok := t.locations[id]; !ok {
+		return nil
+	}
+	if _, err := fmt.Fprintf(t.f, "%s %s\n", id, removed); err != nil {
+		return err
+	}
+	delete(t.locations, id)
+	delete(t.trash, id)
+	return nil
+}
+
+// moveToTrash records that a cell was moved to the trash at ts.
+func (t *offsetTable) moveToTrash(id string, ts int64) error {
+	if _, err := writeTrashEntry(t.f, id, ts); err != nil {
+		return err
+	}
+	t.trash[id] = ts
+	return nil
+}
+
+// restore records that a cell was taken back out of the trash.
+func (t *offsetTable) restore(id string) error {
+	if _, err := fmt.Fprintf(t.f, "%s %s\n", id, restored); err != nil {
+		return err
+	}
+	delete(t.trash, id)
+	return nil
+}
+
+// trashedAt returns when the cell with the given identifier was moved to
+// the trash, if it is in the trash.
+func (t *offsetTable) trashedAt(id string) (int64, bool) {
+	ts, ok := t.trash[id]
+	return ts, ok
+}
+
+func (t *offsetTable) close() error {
+	if t.f == nil {
+		return nil
+	}
+	return t.f.Close()
+}
+
+func writeTableEntry(w io.Writer, id string, loc location, alias string) (int, error) {
+	if alias != "" {
+		return fmt.Fprintf(w, "%s %d %d %s\n", id, loc.offset, loc.size, alias)
+	}
+	return fmt.Fprintf(w, "%s %d %d\n", id, loc.offset, loc.size)
+}
+
+func writeTrashEntry(w io.Writer, id string, ts int64) (int, error) {
+	return fmt.Fprintf(w, "%s %s %d\n", id, trashed, ts)
+}
@@ -0,0 +1,76 @@
+package brain
+
+import (
+	"regexp"
+	"strings"
+)
+
+// hashtag matches a #tag that starts a word, and has at least one letter
+// so that issue numbers such as #12 aren't taken for tags.
+var hashtag = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_/&#])#([\p{L}\p{N}_-]*\p{L}[\p{L}\p{N}_-]*)`)
+
+// A Tag is a tag used by one or more cells.
+type Tag struct {
+	Name string
+
+	// Count is how many live cells have the tag.
+	Count int
+}
+
+// ParseTags returns the #tags in s, lower-cased and without the #, in the
+// order they first appear.
+func ParseTags(s string) []string {
+	return mergeTags(nil, hashtagsIn(s))
+}
+
+func hashtagsIn(s string) []string {
+	var tags []string
+	for _, m := range hashtag.FindAllStringSubmatch(s, -1) {
+		tags = append(tags, m[1])
+	}
+	return tags
+}
+
+// mergeTags returns the tags in a followed by those in b that aren't in a,
+// normalised as ParseTags does.
+func mergeTags(a, b []string) []string {
+	var tags []string
+	seen := make(map[string]bool, len(a)+len(b))
+	for _, list := range [][]string{a, b} {
+		for _, t := range list {
+			t = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(t), "#"))
+			if t == "" || seen[t] {
+				continue
+			}
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// Tags returns the cell's tags, which are the #tags in its data along with
+// any it was given by its store, such as the tags in the front matter of a
+// Markdown file.
+func (c *Cell) Tags() []string {
+	return mergeTags(c.tags, hashtagsIn(c.data))
+}
+
+// Tags returns every tag used by a live cell along with how many cells use
+// it, the most used first. Cells with a tag can be searched for with
+// tag:name, in any search mode.
+func (b *Brain) Tags() ([]Tag, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	found, err := b.search.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]Tag, len(found))
+	for i, t := range found {
+		tags[i] = Tag{Name: t.Name, Count: t.Count}
+	}
+	return tags, nil
+}
@@ -0,0 +1,61 @@
+package brain
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sno6/brain/search"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"#golang", []string{"golang"}},
+		{"learning #Go and #golang, #go again", []string{"go", "golang"}},
+		{"(#draft) #to-do #snake_case", []string{"draft", "to-do", "snake_case"}},
+		{"fixes #12 and #2022-01", nil},
+		{"see example.com/#anchor and a&#39;b", nil},
+		{"not a#tag or ##double", nil},
+		{"#über", []string{"über"}},
+	}
+	for _, tt := range tests {
+		if got := ParseTags(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTags(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	b, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	writeCell(t, b, "#go #rust")
+	writeCell(t, b, "more #Go")
+	trashed := writeCell(t, b, "#zig")
+	if err := b.Delete(trashed); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := b.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Tag{{Name: "go", Count: 2}, {Name: "rust", Count: 1}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("Tags() = %v, want %v", tags, want)
+	}
+
+	for _, mode := range []search.Mode{search.Keyword, search.Advanced} {
+		page, err := b.List(search.Request{Query: "tag:go", Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 2 {
+			t.Errorf("tag:go in mode %d found %d cells, want 2", mode, page.Total)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package brain
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// DefaultTrashRetention is how long deleted cells stay in the trash
+// before they are purged for good.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// DefaultHistoryLimit is how many earlier revisions of each cell are kept
+// when .data is compacted.
+const DefaultHistoryLimit = 50
+
+// ErrNotInTrash is returned when restoring or purging a cell that isn't
+// in the trash.
+var ErrNotInTrash = errors.New("cell is not in the trash")
+
+// SetTrashRetention sets how long deleted cells stay in the trash before
+// they are purged. A retention of 0 keeps them until the trash is emptied.
+func (b *Brain) SetTrashRetention(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.retention = d
+}
+
+// Trash returns the cells that have been deleted but not yet purged,
+// most recently deleted first.
+func (b *Brain) Trash() ([]*Cell, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	trash, err := b.store.Trashed()
+	if err != nil {
+		return nil, err
+	}
+
+	cells := make([]*Cell, 0, len(trash))
+	for id := range trash {
+		cell, err := b.read(id)
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell)
+	}
+
+	sort.Slice(cells, func(i, j int) bool {
+		return cells[i].trashed > cells[j].trashed
+	})
+	return cells, nil
+}
+
+// Restore takes a cell back out of the trash and indexes it again.
+func (b *Brain) Restore(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+
+	cell, err := b.trashed(id)
+	if err != nil {
+		return err
+	}
+	if err := b.store.SetTrashed(cell.id, 0); err != nil {
+		return err
+	}
+	return b.search.Index(cell.id, b.document(cell))
+}
+
+// Purge deletes a cell from the trash for good, along with the files
+// attached to it that no other cell has. A brain that keeps its cells in
+// .data drops them from it at the next compaction, and the files attached
+// to their earlier revisions with them.
+func (b *Brain) Purge(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	if err := b.purge(id); err != nil {
+		return err
+	}
+	return b.removeUnusedBlobs()
+}
+
+func (b *Brain) purge(id string) error {
+	cell, err := b.trashed(id)
+	if err != nil {
+		return err
+	}
+	if err := b.store.Delete(cell.id); err != nil {
+		return err
+	}
+	return b.search.ForgetViewed(cell.id)
+}
+
+// trashed reads a cell that is in the trash, returning ErrNotInTrash if
+// it isn't.
+func (b *Brain) trashed(id string) (*Cell, error) {
+	cell, err := b.read(id)
+	if errors.Is(err, ErrUnknownCell) {
+		return nil, ErrNotInTrash
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cell.trashed == 0 {
+		return nil, ErrNotInTrash
+	}
+	return cell, nil
+}
+
+// EmptyTrash purges every cell in the trash and returns how many were
+// purged.
+func (b *Brain) EmptyTrash() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	trash, err := b.store.Trashed()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for id := range trash {
+		if err := b.purge(id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, b.removeUnusedBlobs()
+}
+
+// PurgeExpired purges cells that have been in the trash for longer than
+// the retention period and returns how many were purged. It is also run
+// when a Brain is opened and as part of every compaction.
+func (b *Brain) PurgeExpired() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return 0, ErrReadOnly
+	}
+	return b.purgeExpired()
+}
+
+func (b *Brain) purgeExpired() (int, error) {
+	if b.retention == 0 {
+		return 0, nil
+	}
+
+	trash, err := b.store.Trashed()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	cutoff := time.Now().Add(-b.retention).Unix()
+	for id, ts := range trash {
+		if ts >= cutoff {
+			continue
+		}
+		if err := b.purge(id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, b.removeUnusedBlobs()
+}
@@ -0,0 +1,40 @@
+package brain
+
+import "testing"
+
+func TestRestoreKeepsWhenViewed(t *testing.T) {
+	b, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	id := writeCell(t, b, "viewed")
+	if err := b.MarkViewed(id); err != nil {
+		t.Fatal(err)
+	}
+	viewed := b.search.LastViewed(id)
+	if viewed.IsZero() {
+		t.Fatal("MarkViewed() didn't record the view")
+	}
+
+	if err := b.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Restore(id); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.search.LastViewed(id); !got.Equal(viewed) {
+		t.Errorf("viewed at %v after restoring, want %v", got, viewed)
+	}
+
+	if err := b.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Purge(id); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.search.LastViewed(id); !got.IsZero() {
+		t.Errorf("viewed at %v after purging, want it forgotten", got)
+	}
+}
@@ -1,15 +1,29 @@
 package tui
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/sno6/brain"
+	"github.com/sno6/brain/search"
 )
 
 // Base app styling for the whole user interface.
 var appStyle = lipgloss.NewStyle().Padding(1, 2)
 
+// errorStyle is how changes that failed, and why, are shown below what the
+// user was changing.
+var errorStyle = lipgloss.
+	NewStyle().
+	Foreground(lipgloss.Color("#F25D94")).
+	MarginLeft(1)
+
 // App is the entrypoint for the Brain UI.
 type App struct {
 	brain *brain.Brain
@@ -21,18 +35,62 @@ type App struct {
 	search   *searchModel
 	cellList *cellListModel
 	cellView *cellViewModel
+	trash    *trashModel
+	tags     *tagsModel
+
+	conflicts *conflictsModel
+
+	// The ID of the last cell the user deleted, so that it can be undone.
+	lastDeleted string
 }
 
 // NewApp returns a new tea.Model with all sub models.
 func NewApp(brain *brain.Brain, startingPage Page) *App {
-	return &App{
+	a := &App{
 		brain:    brain,
 		curPage:  startingPage,
 		index:    newIndexModel(),
 		search:   newSearchModel(),
 		cellList: newCellListModel(),
 		cellView: newCellViewModel(),
+		trash:    newTrashModel(),
+		tags:     newTagsModel(),
+
+		conflicts: newConflictsModel(),
+	}
+
+	// Changes pulled from another copy of the brain need resolving.
+	if conflicts, _ := brain.Conflicts(); len(conflicts) > 0 {
+		a.index.addAction(actionItem{
+			title:       "Conflicts",
+			description: "Resolve cells changed in two places at once",
+			page:        PageConflicts,
+		})
 	}
+
+	// Another process has the brain open, so changes will be refused.
+	if brain.ReadOnly() {
+		a.index.actions.Title += readOnlyTitle
+		a.cellList.cells.Title += readOnlyTitle
+	}
+
+	// The scheduled backup failed as the brain was opened, brain stats
+	// says why.
+	if brain.LastBackupError() != nil {
+		a.index.actions.Title += backupFailedTitle
+	}
+	return a
+}
+
+const (
+	readOnlyTitle     = " (read-only)"
+	backupFailedTitle = " (backup failed)"
+)
+
+// SetOrder sets the order the cells found by searches are listed in, until
+// the user picks another.
+func (a *App) SetOrder(o search.Order) {
+	a.search.setOrder(o)
 }
 
 // Init initialises all sub models.
@@ -43,6 +101,10 @@ func (a *App) Init() tea.Cmd {
 		a.search.Init(),
 		a.cellList.Init(),
 		a.cellView.Init(),
+		a.trash.Init(),
+		a.tags.Init(),
+		a.conflicts.Init(),
+		a.rerunSearch(),
 	)
 }
 
@@ -54,8 +116,14 @@ func (a *App) View() string {
 	case PageSearch:
 		s := lipgloss.JoinVertical(0, a.cellList.View(), a.search.View())
 		return appStyle.Render(s)
-	case PageWrite, PageView:
+	case PageWrite, PageView, PageHistory, PageMetadata, PageAttachments:
 		return appStyle.Render(a.cellView.View())
+	case PageTrash:
+		return appStyle.Render(a.trash.View())
+	case PageTags:
+		return appStyle.Render(a.tags.View())
+	case PageConflicts:
+		return appStyle.Render(a.conflicts.View())
 	}
 	return "<unknown page>"
 }
@@ -78,6 +146,15 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.Type {
 		case tea.KeyCtrlC, tea.KeyEsc:
 			return a, tea.Quit
+		case tea.KeyCtrlZ:
+			// Undo the last delete from the search page.
+			if a.curPage == PageSearch && a.lastDeleted != "" {
+				if err := a.brain.Restore(a.lastDeleted); err != nil {
+					return a, showSearchError(fmt.Errorf("couldn't undo: %w", err))
+				}
+				a.setLastDeleted("")
+				return a, a.rerunSearch()
+			}
 		}
 	}
 
@@ -85,28 +162,103 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if p, ok := msg.(Page); ok {
 		a.cellView.setEditable(p == PageWrite)
 		a.curPage = p
+
+		switch p {
+		case PageTrash:
+			cmd = tea.Batch(cmd, a.listTrash())
+		case PageTags:
+			cmd = tea.Batch(cmd, a.listTags())
+		case PageConflicts:
+			cmd = tea.Batch(cmd, a.listConflicts())
+		case PageSearch:
+			// Nothing has been listed yet if the app started on another
+			// page, and the cell the user was viewing moves to the top of
+			// the cells viewed most recently.
+			if len(a.cellList.cells.Items()) == 0 || a.search.order() == search.RecentlyViewed {
+				cmd = tea.Batch(cmd, a.rerunSearch())
+			}
+		}
 	}
 
 	if dm, ok := msg.(deleteCellMessage); ok {
-		// Delete the cell from our index.
-		a.brain.Delete(string(dm))
-
-		// Change the page back to search and rerun the last search query.
+		// Move the cell to the trash, and change the page back to search
+		// and rerun the last search query, or say why it couldn't be.
 		a.curPage = PageSearch
-		cmd = tea.Batch(cmd, a.searchBrain(searchMessage{
-			mode: a.search.modes[a.search.currModeIdx].mode,
-			val:  a.search.input.Value(),
-		}))
+		if err := a.brain.Delete(string(dm)); err != nil {
+			cmd = tea.Batch(cmd, showSearchError(fmt.Errorf("couldn't delete: %w", err)))
+		} else {
+			a.setLastDeleted(string(dm))
+			cmd = tea.Batch(cmd, a.rerunSearch())
+		}
+	}
+
+	if id, ok := msg.(restoreCellMessage); ok {
+		if err := a.brain.Restore(string(id)); err != nil {
+			return a, showTrashError(fmt.Errorf("couldn't restore: %w", err))
+		}
+		if string(id) == a.lastDeleted {
+			a.setLastDeleted("")
+		}
+		cmd = tea.Batch(cmd, a.listTrash())
+	}
+
+	if id, ok := msg.(purgeCellMessage); ok {
+		if err := a.brain.Purge(string(id)); err != nil {
+			return a, showTrashError(fmt.Errorf("couldn't purge: %w", err))
+		}
+		if string(id) == a.lastDeleted {
+			a.setLastDeleted("")
+		}
+		cmd = tea.Batch(cmd, a.listTrash())
+	}
+
+	if rm, ok := msg.(resolveConflictMessage); ok {
+		if err := a.brain.ResolveConflict(rm.id, rm.theirs); err != nil {
+			return a, showConflictError(fmt.Errorf("couldn't resolve: %w", err))
+		}
+		cmd = tea.Batch(cmd, a.listConflicts())
 	}
 
-	// The user has clicked ctrl+s on the write cell page.
+	// The user has clicked ctrl+s on the write cell page. If the cell
+	// can't be saved, such as when the brain is read-only, what they wrote
+	// stays in the editor along with why.
 	if c, ok := msg.(savedCell); ok {
+		var err error
 		if c.docID != "" {
-			a.brain.Delete(c.docID)
+			err = a.brain.Edit(c.docID, c.content)
+		} else {
+			err = a.brain.Write(c.content)
 		}
+		if err != nil {
+			return a, func() tea.Msg { return saveError{id: c.docID, err: err} }
+		}
+		return a, tea.Batch(cmd, changePage(PageSearch), a.rerunSearch())
+	}
+
+	// The user has followed a link, or gone back to where they followed
+	// one from.
+	if id, ok := msg.(openCellMessage); ok {
+		cell, err := a.brain.ResolveLink(string(id))
+		if err != nil {
+			return a, cmd
+		}
+		return a, tea.Batch(cmd, viewCellCommand(cell.Identifier(), cell.Data(), cell.Metadata()))
+	}
 
-		a.brain.Write(c.content)
-		return a, tea.Batch(cmd, changePage(PageSearch))
+	// The user has picked a tag, search for the cells that have it.
+	if t, ok := msg.(tagFilterMessage); ok {
+		a.curPage = PageSearch
+		search := a.search.setQuery("tag:" + string(t))
+		return a, tea.Batch(cmd, search)
+	}
+
+	// The user has saved the metadata of the cell they are viewing.
+	if m, ok := msg.(savedMetadata); ok {
+		if err := a.brain.SetMetadata(m.docID, m.meta); err != nil {
+			return a, func() tea.Msg { return metadataError{err} }
+		}
+		a.cellView.reset()
+		return a, tea.Batch(cmd, changePage(PageSearch), a.rerunSearch())
 	}
 
 	cmd = tea.Batch(cmd, a.updateSubModels(msg))
@@ -115,7 +267,33 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Send what they typed to Brain and create a tea.Cmd for the results,
 	// so that cells can listen and display the findings.
 	if s, ok := msg.(searchMessage); ok {
-		cmd = tea.Batch(cmd, a.searchBrain(s))
+		cmd = tea.Batch(cmd, a.startSearch(s))
+	}
+
+	// The user is nearing the end of the cells found so far.
+	if p, ok := msg.(nextPageMessage); ok {
+		cmd = tea.Batch(cmd, a.searchBrain(p.search, p.offset))
+	}
+
+	// The user is viewing a cell, find what it links to and what links to
+	// it, and remember that they viewed it.
+	if v, ok := msg.(viewCellMessage); ok {
+		cmd = tea.Batch(cmd, a.cellLinks(v.id), a.markViewed(v.id))
+	}
+
+	// The user has opened the history of the cell they are viewing.
+	if h, ok := msg.(historyMessage); ok {
+		cmd = tea.Batch(cmd, a.cellHistory(string(h)))
+	}
+
+	// The user has opened the attachments of the cell they are viewing.
+	if id, ok := msg.(attachmentsMessage); ok {
+		cmd = tea.Batch(cmd, a.cellAttachments(string(id)))
+	}
+
+	// The user wants a copy of an attachment.
+	if e, ok := msg.(extractAttachmentMessage); ok {
+		cmd = tea.Batch(cmd, a.extractAttachment(brain.Attachment(e)))
 	}
 
 	return a, cmd
@@ -127,13 +305,19 @@ func (a *App) updateSubModels(msg tea.Msg) tea.Cmd {
 	switch a.curPage {
 	case PageIndex:
 		a.index, cmd = a.index.Update(msg)
-	case PageWrite, PageView:
+	case PageWrite, PageView, PageHistory, PageMetadata, PageAttachments:
 		a.cellView, cmd = a.cellView.Update(msg)
 	case PageSearch:
 		var searchCmd, cellListCmd tea.Cmd
 		a.search, searchCmd = a.search.Update(msg)
 		a.cellList, cellListCmd = a.cellList.Update(msg)
 		cmd = tea.Batch(cmd, searchCmd, cellListCmd)
+	case PageTrash:
+		a.trash, cmd = a.trash.Update(msg)
+	case PageTags:
+		a.tags, cmd = a.tags.Update(msg)
+	case PageConflicts:
+		a.conflicts, cmd = a.conflicts.Update(msg)
 	}
 
 	return cmd
@@ -147,13 +331,209 @@ func (a *App) propagateDimensions(width, height int) {
 	a.search.setDimensions(width, height)
 	a.cellView.setDimensions(width, height)
 	a.cellList.setDimensions(width, height)
+	a.trash.setDimensions(width, height)
+	a.tags.setDimensions(width, height)
+	a.conflicts.setDimensions(width, height)
+}
+
+func (a *App) setLastDeleted(id string) {
+	a.lastDeleted = id
+	a.search.help.setUndoable(id != "")
+}
+
+// listItems are a page of the cells found by a search.
+type listItems struct {
+	search searchMessage
+	page   *brain.Page
+}
+
+// A searchError is why a search failed, such as a query that can't be
+// parsed, which is shown in the search bar. It also shows why other
+// changes made from the search page failed, which have no search.
+type searchError struct {
+	err    error
+	search searchMessage
+}
+
+// startSearch searches for the first page of cells, which replaces those
+// on the search page once it arrives. Pages of earlier searches that are
+// still on their way are dropped.
+func (a *App) startSearch(sm searchMessage) func() tea.Msg {
+	a.search.startSearch(sm)
+	a.cellList.startSearch(sm)
+	return a.searchBrain(sm, 0)
+}
+
+// searchBrain searches for the page of cells that starts at offset.
+func (a *App) searchBrain(sm searchMessage, offset int) func() tea.Msg {
+	return func() tea.Msg {
+		page, err := a.brain.List(search.Request{
+			Query:  sm.val,
+			Mode:   sm.mode,
+			Offset: offset,
+			Size:   listPageSize,
+			Order:  sm.order,
+		})
+		if err != nil {
+			return searchError{err: err, search: sm}
+		}
+		return listItems{search: sm, page: page}
+	}
+}
+
+func showSearchError(err error) func() tea.Msg {
+	return func() tea.Msg {
+		return searchError{err: err}
+	}
+}
+
+// rerunSearch reruns the last search query, to pick up changes to cells.
+func (a *App) rerunSearch() func() tea.Msg {
+	return a.startSearch(searchMessage{
+		mode:  a.search.modes[a.search.currModeIdx].mode,
+		val:   a.search.query(),
+		order: a.search.order(),
+	})
+}
+
+func (a *App) markViewed(id string) func() tea.Msg {
+	if a.brain.ReadOnly() {
+		return nil
+	}
+	return func() tea.Msg {
+		a.brain.MarkViewed(id)
+		return nil
+	}
+}
+
+// trashItems are the cells in the trash, most recently deleted first.
+type trashItems []*brain.Cell
+
+// A trashError is why a cell in the trash couldn't be restored or purged.
+type trashError struct {
+	err error
+}
+
+func showTrashError(err error) func() tea.Msg {
+	return func() tea.Msg {
+		return trashError{err}
+	}
+}
+
+func (a *App) listTrash() func() tea.Msg {
+	return func() tea.Msg {
+		cells, _ := a.brain.Trash()
+		return trashItems(cells)
+	}
+}
+
+// tagItems are the tags in use, the most used first.
+type tagItems []list.Item
+
+func (a *App) listTags() func() tea.Msg {
+	return func() tea.Msg {
+		tags, _ := a.brain.Tags()
+		items := make(tagItems, len(tags))
+		for i, t := range tags {
+			items[i] = tagItem{name: t.Name, count: t.Count}
+		}
+		return items
+	}
 }
 
-type listItems []*brain.Cell
+// conflictItems are the conflicts left by pulling the brain, with the
+// local and remote data of each cell.
+type conflictItems []list.Item
 
-func (a *App) searchBrain(sm searchMessage) func() tea.Msg {
+// A conflictError is why a conflict couldn't be resolved.
+type conflictError struct {
+	err error
+}
+
+func showConflictError(err error) func() tea.Msg {
+	return func() tea.Msg {
+		return conflictError{err}
+	}
+}
+
+func (a *App) listConflicts() func() tea.Msg {
+	return func() tea.Msg {
+		conflicts, _ := a.brain.Conflicts()
+		items := make(conflictItems, 0, len(conflicts))
+		for _, c := range conflicts {
+			var ours string
+			if cell, err := a.brain.Read(c.ID); err == nil {
+				ours = cell.Data()
+			}
+			items = append(items, conflictItem{
+				id:     c.ID,
+				path:   c.Path,
+				ours:   ours,
+				theirs: c.Theirs,
+			})
+		}
+		return items
+	}
+}
+
+func (a *App) cellLinks(id string) func() tea.Msg {
+	return func() tea.Msg {
+		var links []link
+		if out, err := a.brain.Links(id); err == nil {
+			for _, l := range out {
+				links = append(links, link{id: l.ID, title: l.Target})
+			}
+		}
+		if back, err := a.brain.Backlinks(id); err == nil {
+			for _, c := range back {
+				title := preview(c.Data())
+				if t := c.Metadata()["title"]; t != "" {
+					title = t
+				}
+				links = append(links, link{id: c.Identifier(), title: title, back: true})
+			}
+		}
+		return cellLinks{id: id, links: links}
+	}
+}
+
+// historyItems are the revisions of a cell, newest first.
+type historyItems []*brain.Cell
+
+func (a *App) cellHistory(id string) func() tea.Msg {
+	return func() tea.Msg {
+		cells, _ := a.brain.History(id)
+		return historyItems(cells)
+	}
+}
+
+// attachmentItems are the files attached to a cell.
+type attachmentItems []brain.Attachment
+
+func (a *App) cellAttachments(id string) func() tea.Msg {
 	return func() tea.Msg {
-		cells, _ := a.brain.List(sm.val, sm.mode)
-		return listItems(cells)
+		cell, err := a.brain.Read(id)
+		if err != nil {
+			return attachmentItems(nil)
+		}
+		return attachmentItems(cell.Attachments())
+	}
+}
+
+// extractAttachment copies an attachment to the current folder, adding a
+// number to its name if there's already a file with that name.
+func (a *App) extractAttachment(att brain.Attachment) func() tea.Msg {
+	return func() tea.Msg {
+		ext := filepath.Ext(att.Name)
+		base := strings.TrimSuffix(att.Name, ext)
+
+		fn := att.Name
+		for i := 1; ; i++ {
+			err := a.brain.ExtractAttachment(att, fn)
+			if !os.IsExist(err) {
+				return extractedAttachment{path: fn, err: err}
+			}
+			fn = fmt.Sprintf("%s (%d)%s", base, i, ext)
+		}
 	}
 }
@@ -0,0 +1,106 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/sno6/brain"
+)
+
+// How many attachments to show at once in the attachments pane.
+const attachmentsHeight = 5
+
+var attachmentStatusStyle = lipgloss.
+	NewStyle().
+	MarginLeft(1)
+
+// An attachmentsModel lists the files attached to a cell so that the user
+// can extract them.
+type attachmentsModel struct {
+	files list.Model
+
+	// What happened to the last attachment the user extracted.
+	status string
+}
+
+func newAttachmentsModel() *attachmentsModel {
+	files := list.New(nil, attachmentDelegate{}, 60, attachmentsHeight)
+	files.SetShowTitle(false)
+	files.SetShowPagination(false)
+	files.SetFilteringEnabled(false)
+	files.SetShowStatusBar(false)
+	files.SetShowHelp(false)
+	files.KeyMap.NextPage = key.NewBinding()
+	files.KeyMap.PrevPage = key.NewBinding()
+	files.DisableQuitKeybindings()
+
+	return &attachmentsModel{files: files}
+}
+
+func (a *attachmentsModel) Update(msg tea.Msg) (*attachmentsModel, tea.Cmd) {
+	var cmd tea.Cmd
+	a.files, cmd = a.files.Update(msg)
+	return a, cmd
+}
+
+func (a *attachmentsModel) View() string {
+	view := a.files.View()
+	if a.status != "" {
+		view = lipgloss.JoinVertical(0, view, attachmentStatusStyle.Render(a.status))
+	}
+	return view
+}
+
+func (a *attachmentsModel) setAttachments(items attachmentItems) {
+	files := make([]list.Item, len(items))
+	for i, f := range items {
+		files[i] = attachmentItem(f)
+	}
+	a.files.SetItems(files)
+	a.files.Select(0)
+	a.status = ""
+}
+
+// selected returns the attachment the cursor is on.
+func (a *attachmentsModel) selected() (brain.Attachment, bool) {
+	f, ok := a.files.SelectedItem().(attachmentItem)
+	return brain.Attachment(f), ok
+}
+
+func (a *attachmentsModel) setWidth(width int) {
+	a.files.SetSize(width, attachmentsHeight)
+}
+
+// An attachmentItem is the UI element for a row in the attachments pane.
+type attachmentItem brain.Attachment
+
+func (attachmentItem) FilterValue() string { return "" }
+
+type attachmentDelegate struct{}
+
+func (d attachmentDelegate) Height() int                             { return 1 }
+func (d attachmentDelegate) Spacing() int                            { return 0 }
+func (d attachmentDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d attachmentDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	item, ok := listItem.(attachmentItem)
+	if !ok {
+		return
+	}
+
+	data := lipgloss.NewStyle().Bold(true).Render(item.Name) + " • " + item.Hash[:12]
+
+	var cursor string
+	if index == m.Index() {
+		cursor = cursorStyle.Render("➜ ")
+		data = selectedItemStyle.Render(data)
+	} else {
+		data = "  " + data
+	}
+
+	fmt.Fprintf(w, "%s%s", cursor, data)
+}
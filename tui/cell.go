@@ -33,8 +33,11 @@ var (
 type cellViewModel struct {
 	text     textarea.Model
 	help     *helpModel
+	history  *historyModel
 	editable bool
 
+	width, height int
+
 	// The ID of the document that we are currently viewing.
 	currentDocID string
 
@@ -42,6 +45,24 @@ type cellViewModel struct {
 	// so we can hide the help and present an "Are you sure?" message.
 	deleteDialogOpen bool
 	deleteOption     bool
+
+	// The user has clicked 'h' on a cell and is browsing its revisions.
+	historyOpen bool
+
+	// The user has clicked 'a' on a cell and is browsing its attachments.
+	attachments     *attachmentsModel
+	attachmentsOpen bool
+
+	// The cell's metadata, which the user can edit by clicking 'm'.
+	metadata *metadataModel
+
+	// Why the cell couldn't be saved, which is shown below the editor.
+	saveErr error
+
+	// The cell's links and backlinks, which the user can pick with 'l'
+	// and follow with enter, and the cells they followed links from.
+	links     *linksModel
+	backStack []string
 }
 
 func newCellViewModel() *cellViewModel {
@@ -56,6 +77,10 @@ func newCellViewModel() *cellViewModel {
 	return &cellViewModel{
 		text:         text,
 		help:         newHelpModel(PageView),
+		history:      newHistoryModel(),
+		attachments:  newAttachmentsModel(),
+		metadata:     newMetadataModel(),
+		links:        newLinksModel(),
 		deleteOption: true,
 	}
 }
@@ -66,9 +91,26 @@ func (c *cellViewModel) Init() tea.Cmd {
 
 // View renders the app by rendering all sub models.
 func (c *cellViewModel) View() string {
-	views := []string{
-		titleStyle.Render("Brain 🧠"),
-		c.text.View(),
+	views := []string{titleStyle.Render("Brain 🧠")}
+
+	switch {
+	case c.historyOpen && c.history.diff:
+		views = append(views, c.history.View(), c.renderDiff())
+	case c.historyOpen:
+		views = append(views, c.history.View(), c.text.View())
+	case c.attachmentsOpen:
+		views = append(views, c.attachments.View(), c.text.View())
+	default:
+		views = append(views, c.text.View())
+		if c.editable && c.saveErr != nil {
+			views = append(views, errorStyle.Render("Couldn't save: "+c.saveErr.Error()))
+		}
+		if !c.editable && !c.metadata.empty() {
+			views = append(views, c.metadata.View())
+		}
+		if !c.editable && !c.metadata.editing && !c.links.empty() {
+			views = append(views, c.links.View())
+		}
 	}
 
 	if c.deleteDialogOpen {
@@ -81,8 +123,38 @@ func (c *cellViewModel) View() string {
 }
 
 func (c *cellViewModel) Update(msg tea.Msg) (*cellViewModel, tea.Cmd) {
+	// The revisions of the cell have been loaded, open the history pane.
+	if items, ok := msg.(historyItems); ok && len(items) > 0 {
+		c.history.setRevisions(items)
+		c.historyOpen = true
+		c.help.setPage(PageHistory)
+		c.resizeText()
+	}
+
+	// The attachments of the cell have been loaded, open their pane.
+	if items, ok := msg.(attachmentItems); ok && len(items) > 0 {
+		c.attachments.setAttachments(items)
+		c.attachmentsOpen = true
+		c.help.setPage(PageAttachments)
+		c.resizeText()
+	}
+
+	if c.historyOpen {
+		return c.updateHistory(msg)
+	}
+	if c.attachmentsOpen {
+		return c.updateAttachments(msg)
+	}
+	if c.metadata.editing {
+		return c.updateMetadata(msg)
+	}
+
 	if c.editable {
 		switch msg := msg.(type) {
+		case saveError:
+			c.currentDocID = msg.id
+			c.saveErr = msg.err
+			return c, nil
 		case tea.KeyMsg:
 			switch msg.Type {
 			case tea.KeyCtrlS:
@@ -104,6 +176,10 @@ func (c *cellViewModel) Update(msg tea.Msg) (*cellViewModel, tea.Cmd) {
 				c.deleteOption = !c.deleteOption
 			case tea.KeyEnter:
 				if !c.deleteDialogOpen {
+					if id := c.links.target(); id != "" {
+						c.backStack = append(c.backStack, c.currentDocID)
+						return c, openCell(id)
+					}
 					break
 				}
 
@@ -124,8 +200,34 @@ func (c *cellViewModel) Update(msg tea.Msg) (*cellViewModel, tea.Cmd) {
 				case "e":
 					c.setEditable(true)
 					return c, changePage(PageWrite)
+				case "h":
+					return c, tea.Batch(
+						changePage(PageHistory),
+						historyCommand(c.currentDocID),
+					)
+				case "a":
+					return c, tea.Batch(
+						changePage(PageAttachments),
+						attachmentsCommand(c.currentDocID),
+					)
+				case "l":
+					c.links.next()
+					c.updateLinkHelp()
+				case "b":
+					if len(c.backStack) == 0 {
+						break
+					}
+					id := c.backStack[len(c.backStack)-1]
+					c.backStack = c.backStack[:len(c.backStack)-1]
+					return c, openCell(id)
+				case "m":
+					c.metadata.edit()
+					c.help.setPage(PageMetadata)
+					c.resizeText()
+					return c, changePage(PageMetadata)
 				case "q":
 					c.reset()
+					c.backStack = nil
 					return c, changePage(PageSearch)
 				}
 			}
@@ -135,6 +237,17 @@ func (c *cellViewModel) Update(msg tea.Msg) (*cellViewModel, tea.Cmd) {
 	if s, ok := msg.(viewCellMessage); ok {
 		c.currentDocID = s.id
 		c.text.SetValue(s.content)
+		c.metadata.setMetadata(s.meta)
+		c.links.setLinks(nil)
+		c.updateLinkHelp()
+		c.resizeText()
+	}
+
+	// The links of the cell have been loaded.
+	if l, ok := msg.(cellLinks); ok && l.id == c.currentDocID {
+		c.links.setLinks(l.links)
+		c.updateLinkHelp()
+		c.resizeText()
 	}
 
 	var helpCmd, textCmd tea.Cmd
@@ -143,6 +256,107 @@ func (c *cellViewModel) Update(msg tea.Msg) (*cellViewModel, tea.Cmd) {
 	return c, tea.Batch(helpCmd, textCmd)
 }
 
+// updateHistory handles messages while the history pane is open. The
+// selected revision is shown in place of the cell's contents.
+func (c *cellViewModel) updateHistory(msg tea.Msg) (*cellViewModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok && msg.Type == tea.KeyRunes {
+		switch msg.String() {
+		case "d":
+			c.history.diff = !c.history.diff
+			return c, nil
+		case "r":
+			// Restoring a revision saves its contents as a new revision.
+			r := c.history.selected()
+			if r.current {
+				return c, nil
+			}
+
+			id := c.currentDocID
+			c.closeHistory()
+			c.reset()
+			return c, saveCell(id, r.data)
+		case "q":
+			c.closeHistory()
+			return c, changePage(PageView)
+		}
+	}
+
+	var cmd tea.Cmd
+	c.history, cmd = c.history.Update(msg)
+	c.text.SetValue(c.history.selected().data)
+	return c, cmd
+}
+
+// updateAttachments handles messages while the attachments pane is open.
+func (c *cellViewModel) updateAttachments(msg tea.Msg) (*cellViewModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.Type != tea.KeyRunes {
+			break
+		}
+		switch msg.String() {
+		case "s":
+			if a, ok := c.attachments.selected(); ok {
+				return c, extractAttachment(a)
+			}
+			return c, nil
+		case "q":
+			c.attachmentsOpen = false
+			c.help.setPage(PageView)
+			c.resizeText()
+			return c, changePage(PageView)
+		}
+	case extractedAttachment:
+		if msg.err != nil {
+			c.attachments.status = "Couldn't save: " + msg.err.Error()
+		} else {
+			c.attachments.status = "Saved to " + msg.path
+		}
+		return c, nil
+	}
+
+	var cmd tea.Cmd
+	c.attachments, cmd = c.attachments.Update(msg)
+	return c, cmd
+}
+
+// updateMetadata handles messages while the user is editing the cell's
+// metadata.
+func (c *cellViewModel) updateMetadata(msg tea.Msg) (*cellViewModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlS {
+			return c, saveMetadata(c.currentDocID, c.metadata.value())
+		}
+	case metadataError:
+		c.metadata.err = msg.err
+		return c, nil
+	}
+
+	var cmd tea.Cmd
+	c.metadata, cmd = c.metadata.Update(msg)
+	return c, cmd
+}
+
+func (c *cellViewModel) updateLinkHelp() {
+	c.help.setLinks(!c.links.empty(), c.links.target() != "", len(c.backStack) > 0)
+}
+
+func (c *cellViewModel) closeHistory() {
+	c.text.SetValue(c.history.current().data)
+	c.historyOpen = false
+	c.help.setPage(PageView)
+	c.resizeText()
+}
+
+func (c *cellViewModel) renderDiff() string {
+	return focusedStyle.
+		Width(c.width - 5).
+		Height(c.text.Height()).
+		MaxHeight(c.text.Height() + 2).
+		Render(c.history.renderDiff())
+}
+
 func (c *cellViewModel) renderDeleteDialog() string {
 	var options string
 	if c.deleteOption {
@@ -151,12 +365,37 @@ func (c *cellViewModel) renderDeleteDialog() string {
 		options = "yes / " + questionSelectedStyle.Render("no")
 	}
 
-	return deleteQuestionStyle.Render(fmt.Sprintf("Are you sure? %s", options))
+	return deleteQuestionStyle.Render(fmt.Sprintf("Move to trash? %s", options))
 }
 
 func (c *cellViewModel) setDimensions(width, height int) {
+	c.width, c.height = width, height
 	c.text.SetWidth(width - 5)
-	c.text.SetHeight(int(float64(height) * 0.7))
+	c.history.setWidth(width - 5)
+	c.attachments.setWidth(width - 5)
+	c.metadata.setWidth(width - 5)
+	c.links.setWidth(width - 5)
+	c.resizeText()
+}
+
+// resizeText sizes the text area to fit alongside the history pane or
+// the metadata when they are open, and the links when there are any.
+func (c *cellViewModel) resizeText() {
+	h := int(float64(c.height) * 0.7)
+	switch {
+	case c.historyOpen:
+		h -= historyHeight
+	case c.attachmentsOpen:
+		h -= attachmentsHeight + 1
+	case c.metadata.editing:
+		h -= metadataHeight + 2
+	case !c.metadata.empty():
+		h -= len(c.metadata.meta) + 2
+	}
+	if !c.historyOpen && !c.attachmentsOpen && !c.metadata.editing && !c.links.empty() {
+		h -= c.links.height() + 2
+	}
+	c.text.SetHeight(h)
 }
 
 func (c *cellViewModel) setEditable(e bool) {
@@ -166,13 +405,25 @@ func (c *cellViewModel) setEditable(e bool) {
 		c.editable = true
 	} else {
 		c.text.Blur()
-		c.help.setPage(PageView)
 		c.editable = false
+
+		switch {
+		case c.historyOpen:
+			c.help.setPage(PageHistory)
+		case c.attachmentsOpen:
+			c.help.setPage(PageAttachments)
+		default:
+			c.help.setPage(PageView)
+		}
 	}
 }
 
 func (c *cellViewModel) reset() {
 	c.currentDocID = ""
+	c.saveErr = nil
 	c.deleteDialogOpen = false
 	c.deleteOption = true
+	c.metadata.close()
+	c.metadata.setMetadata(nil)
+	c.links.setLinks(nil)
 }
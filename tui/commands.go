@@ -2,6 +2,7 @@ package tui
 
 import (
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sno6/brain"
 	"github.com/sno6/brain/search"
 )
 
@@ -14,6 +15,12 @@ const (
 	PageSearch
 	PageWrite
 	PageView
+	PageHistory
+	PageTrash
+	PageConflicts
+	PageMetadata
+	PageTags
+	PageAttachments
 )
 
 func changePage(p Page) func() tea.Msg {
@@ -30,9 +37,38 @@ func deleteCell(id string) func() tea.Msg {
 	}
 }
 
+type restoreCellMessage string
+
+func restoreCell(id string) func() tea.Msg {
+	return func() tea.Msg {
+		return restoreCellMessage(id)
+	}
+}
+
+type purgeCellMessage string
+
+func purgeCell(id string) func() tea.Msg {
+	return func() tea.Msg {
+		return purgeCellMessage(id)
+	}
+}
+
+// A resolveConflictMessage asks to resolve the conflict for a cell by
+// keeping the local revision, or the remote one if theirs is set.
+type resolveConflictMessage struct {
+	id     string
+	theirs bool
+}
+
+func resolveConflict(id string, theirs bool) func() tea.Msg {
+	return func() tea.Msg {
+		return resolveConflictMessage{id: id, theirs: theirs}
+	}
+}
+
 // A savedCell is a message type that is passed to an App update
 // when the user saves a cell. If docID is present the user is editing
-// the document and we should remove the original before writing the new value.
+// the document and the new value should supersede the original.
 type savedCell struct {
 	docID   string
 	content string
@@ -44,28 +80,131 @@ func saveCell(docID, content string) func() tea.Msg {
 	}
 }
 
+// A tagFilterMessage asks to list the cells with the given tag.
+type tagFilterMessage string
+
+func filterByTag(tag string) func() tea.Msg {
+	return func() tea.Msg {
+		return tagFilterMessage(tag)
+	}
+}
+
 // A searchMessage contains the contents of the search bar, and is
 // sent to other models when the user stops typing briefly.
 type searchMessage struct {
-	mode search.Mode
-	val  string
+	mode  search.Mode
+	val   string
+	order search.Order
 }
 
-func searchCommand(mode search.Mode, val string) func() tea.Msg {
+func searchCommand(mode search.Mode, val string, order search.Order) func() tea.Msg {
 	return func() tea.Msg {
 		return searchMessage{
-			mode: mode,
-			val:  val,
+			mode:  mode,
+			val:   val,
+			order: order,
 		}
 	}
 }
 
+// A nextPageMessage asks for the page of cells found by a search that
+// starts at offset.
+type nextPageMessage struct {
+	search searchMessage
+	offset int
+}
+
+func nextPage(search searchMessage, offset int) func() tea.Msg {
+	return func() tea.Msg {
+		return nextPageMessage{search: search, offset: offset}
+	}
+}
+
 type viewCellMessage struct {
 	id, content string
+	meta        map[string]string
 }
 
-func viewCellCommand(id, content string) func() tea.Msg {
+func viewCellCommand(id, content string, meta map[string]string) func() tea.Msg {
 	return func() tea.Msg {
-		return viewCellMessage{id: id, content: content}
+		return viewCellMessage{id: id, content: content, meta: meta}
 	}
 }
+
+// An openCellMessage asks to view the cell with the given ID, or the
+// latest revision of it.
+type openCellMessage string
+
+func openCell(id string) func() tea.Msg {
+	return func() tea.Msg {
+		return openCellMessage(id)
+	}
+}
+
+// A cellLinks holds the links of the cell with the given ID, followed by
+// the cells that link to it.
+type cellLinks struct {
+	id    string
+	links []link
+}
+
+// A savedMetadata is passed to an App update when the user saves the
+// metadata of the cell with the given docID.
+type savedMetadata struct {
+	docID string
+	meta  map[string]string
+}
+
+func saveMetadata(docID string, meta map[string]string) func() tea.Msg {
+	return func() tea.Msg {
+		return savedMetadata{docID: docID, meta: meta}
+	}
+}
+
+// A metadataError is the reason metadata couldn't be saved.
+type metadataError struct {
+	err error
+}
+
+// A saveError is the reason the cell with the given ID, or a new cell if
+// it is empty, couldn't be saved.
+type saveError struct {
+	id  string
+	err error
+}
+
+// A historyMessage asks for the revisions of the cell with the given ID.
+type historyMessage string
+
+func historyCommand(id string) func() tea.Msg {
+	return func() tea.Msg {
+		return historyMessage(id)
+	}
+}
+
+// An attachmentsMessage asks for the attachments of the cell with the
+// given ID.
+type attachmentsMessage string
+
+func attachmentsCommand(id string) func() tea.Msg {
+	return func() tea.Msg {
+		return attachmentsMessage(id)
+	}
+}
+
+// An extractAttachmentMessage asks to copy an attachment to the current
+// folder.
+type extractAttachmentMessage brain.Attachment
+
+func extractAttachment(a brain.Attachment) func() tea.Msg {
+	return func() tea.Msg {
+		return extractAttachmentMessage(a)
+	}
+}
+
+// An extractedAttachment is where an attachment was copied to, or why it
+// couldn't be.
+type extractedAttachment struct {
+	path string
+	err  error
+}
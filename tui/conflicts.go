@@ -0,0 +1,137 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// How many conflicts to show at once above the diff.
+const conflictsHeight = 5
+
+// A conflictsModel lists the cells that were changed both here and in a
+// brain that was pulled, and shows how the remote revision differs from
+// the local one so that the user can pick which to keep.
+type conflictsModel struct {
+	conflicts list.Model
+	help      *helpModel
+
+	// The rendered diff of the conflict in the cell with the id diffFor,
+	// which is kept until another conflict is selected.
+	diffFor  string
+	diffView string
+
+	// Why the last conflict the user resolved couldn't be.
+	err error
+}
+
+func newConflictsModel() *conflictsModel {
+	conflicts := list.New(nil, conflictDelegate{}, 60, conflictsHeight+2)
+	conflicts.Title = "Conflicts"
+	conflicts.Styles.Title = titleStyle
+	conflicts.Styles.TitleBar = lipgloss.NewStyle().MarginBottom(1)
+	conflicts.SetShowTitle(true)
+	conflicts.SetShowPagination(false)
+	conflicts.SetFilteringEnabled(false)
+	conflicts.SetShowStatusBar(false)
+	conflicts.SetShowHelp(false)
+	conflicts.KeyMap.NextPage = key.NewBinding()
+	conflicts.KeyMap.PrevPage = key.NewBinding()
+	conflicts.DisableQuitKeybindings()
+
+	return &conflictsModel{
+		conflicts: conflicts,
+		help:      newHelpModel(PageConflicts),
+	}
+}
+
+func (c *conflictsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (c *conflictsModel) View() string {
+	views := []string{c.conflicts.View()}
+	if s, ok := c.conflicts.SelectedItem().(conflictItem); ok {
+		if s.id != c.diffFor {
+			c.diffFor = s.id
+			c.diffView = focusedStyle.Render(renderDiff(diffLines(s.ours, s.theirs)))
+		}
+		views = append(views, c.diffView)
+	}
+	if c.err != nil {
+		views = append(views, errorStyle.Render(c.err.Error()))
+	}
+	return lipgloss.JoinVertical(0, append(views, c.help.View())...)
+}
+
+func (c *conflictsModel) Update(msg tea.Msg) (*conflictsModel, tea.Cmd) {
+	var cmd tea.Cmd
+	c.conflicts, cmd = c.conflicts.Update(msg)
+
+	switch msg := msg.(type) {
+	case conflictError:
+		c.err = msg.err
+	case tea.KeyMsg:
+		if msg.Type != tea.KeyRunes {
+			break
+		}
+
+		c.err = nil
+		switch msg.String() {
+		case "o", "t":
+			if s, ok := c.conflicts.SelectedItem().(conflictItem); ok {
+				cmd = tea.Batch(cmd, resolveConflict(s.id, msg.String() == "t"))
+			}
+		case "q":
+			cmd = tea.Batch(cmd, changePage(PageIndex))
+		}
+	}
+
+	if items, ok := msg.(conflictItems); ok {
+		c.conflicts.SetItems(items)
+		c.diffFor, c.diffView = "", ""
+	}
+
+	return c, cmd
+}
+
+func (c *conflictsModel) setDimensions(width, height int) {
+	c.conflicts.SetSize(width, conflictsHeight+2)
+}
+
+// A conflictItem is the UI element for a row in the conflicts list, with
+// the local and remote data of the cell.
+type conflictItem struct {
+	id, path     string
+	ours, theirs string
+}
+
+func (conflictItem) FilterValue() string { return "" }
+
+type conflictDelegate struct{}
+
+func (d conflictDelegate) Height() int                             { return 1 }
+func (d conflictDelegate) Spacing() int                            { return 0 }
+func (d conflictDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d conflictDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	item, ok := listItem.(conflictItem)
+	if !ok {
+		return
+	}
+
+	data := lipgloss.NewStyle().Bold(true).Render(item.path)
+
+	var cursor string
+	if index == m.Index() {
+		cursor = cursorStyle.Render("➜ ")
+		data = selectedItemStyle.Render(data)
+	} else {
+		data = "  " + data
+	}
+
+	fmt.Fprintf(w, "%s%s", cursor, data)
+}
@@ -0,0 +1,172 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	diffAddedStyle = lipgloss.
+			NewStyle().
+			Foreground(lipgloss.AdaptiveColor{Light: "#43BF6D", Dark: "#73F59F"})
+
+	diffRemovedStyle = lipgloss.
+				NewStyle().
+				Foreground(lipgloss.Color("#F25D94"))
+)
+
+type diffOp uint8
+
+const (
+	diffEqual diffOp = iota
+	diffAdded
+	diffRemoved
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// How many lines may be added and removed before diffLines stops looking
+// for the shortest diff, which takes time and memory that grow with its
+// square.
+const maxDiffEdits = 1000
+
+// diffLines returns the lines that need to be removed from and added to
+// a to turn it into b. Lines a and b start and end with are set aside
+// first, and the rest is diffed with Myers' algorithm, unless they differ
+// by more than maxDiffEdits lines, in which case they are all replaced.
+func diffLines(a, b string) []diffLine {
+	as, bs := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	var prefix, suffix int
+	for prefix < len(as) && prefix < len(bs) && as[prefix] == bs[prefix] {
+		prefix++
+	}
+	for suffix < len(as)-prefix && suffix < len(bs)-prefix &&
+		as[len(as)-1-suffix] == bs[len(bs)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(as)+len(bs)-prefix-suffix)
+	for _, l := range as[:prefix] {
+		lines = append(lines, diffLine{op: diffEqual, text: l})
+	}
+
+	middleA, middleB := as[prefix:len(as)-suffix], bs[prefix:len(bs)-suffix]
+	if middle, ok := myersDiff(middleA, middleB); ok {
+		lines = append(lines, middle...)
+	} else {
+		for _, l := range middleA {
+			lines = append(lines, diffLine{op: diffRemoved, text: l})
+		}
+		for _, l := range middleB {
+			lines = append(lines, diffLine{op: diffAdded, text: l})
+		}
+	}
+
+	for _, l := range as[len(as)-suffix:] {
+		lines = append(lines, diffLine{op: diffEqual, text: l})
+	}
+	return lines
+}
+
+// myersDiff returns the shortest diff from a to b, or false if it takes
+// more than maxDiffEdits lines to turn one into the other.
+func myersDiff(a, b []string) ([]diffLine, bool) {
+	limit := len(a) + len(b)
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+
+	// v[off+k] is how far along a the furthest path on diagonal k, where
+	// x-y = k, has got. trace[d] is the part of v that step d of the
+	// search started from, which is all backtracking needs.
+	off := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[off-d-1:off+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < len(a) && y < len(b) && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+
+			if x >= len(a) && y >= len(b) {
+				return backtrack(a, b, trace), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// backtrack follows the paths found by myersDiff back from the ends of a
+// and b to their starts, returning the diff they make.
+func backtrack(a, b []string, trace [][]int) []diffLine {
+	var reversed []diffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[d+k] < v[d+k+2]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+1+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffLine{op: diffEqual, text: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, diffLine{op: diffAdded, text: b[y-1]})
+		} else {
+			reversed = append(reversed, diffLine{op: diffRemoved, text: a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, diffLine{op: diffEqual, text: a[x-1]})
+		x--
+		y--
+	}
+
+	lines := make([]diffLine, len(reversed))
+	for i, l := range reversed {
+		lines[len(reversed)-1-i] = l
+	}
+	return lines
+}
+
+func renderDiff(lines []diffLine) string {
+	rendered := make([]string, len(lines))
+	for i, l := range lines {
+		switch l.op {
+		case diffAdded:
+			rendered[i] = diffAddedStyle.Render("+ " + l.text)
+		case diffRemoved:
+			rendered[i] = diffRemovedStyle.Render("- " + l.text)
+		default:
+			rendered[i] = "  " + l.text
+		}
+	}
+	return strings.Join(rendered, "\n")
+}
@@ -22,6 +22,19 @@ func (h *helpModel) setPage(p Page) {
 	h.keyMap.page = p
 }
 
+// setUndoable shows or hides the key to undo the last delete.
+func (h *helpModel) setUndoable(u bool) {
+	h.keyMap.Undo.SetEnabled(u)
+}
+
+// setLinks shows or hides the keys to pick and follow a link, and to go
+// back to the cell the last link was followed from.
+func (h *helpModel) setLinks(links, selected, back bool) {
+	h.keyMap.NextLink.SetEnabled(links)
+	h.keyMap.FollowLink.SetEnabled(selected)
+	h.keyMap.Back.SetEnabled(back)
+}
+
 func (h *helpModel) Init() tea.Cmd {
 	return nil
 }
@@ -48,6 +61,14 @@ func buildKeyMap(page Page) keyMap {
 			key.WithKeys("tab", "tab"),
 			key.WithHelp("tab", "toggle search"),
 		),
+		DateFilter: key.NewBinding(
+			key.WithKeys("ctrl+t"),
+			key.WithHelp("ctrl+t", "date filter"),
+		),
+		Order: key.NewBinding(
+			key.WithKeys("ctrl+o"),
+			key.WithHelp("ctrl+o", "order"),
+		),
 		Delete: key.NewBinding(
 			key.WithKeys("x", "x"),
 			key.WithHelp("x", "delete"),
@@ -56,6 +77,70 @@ func buildKeyMap(page Page) keyMap {
 			key.WithKeys("e", "e"),
 			key.WithHelp("e", "edit"),
 		),
+		History: key.NewBinding(
+			key.WithKeys("h", "h"),
+			key.WithHelp("h", "history"),
+		),
+		Metadata: key.NewBinding(
+			key.WithKeys("m", "m"),
+			key.WithHelp("m", "metadata"),
+		),
+		NextLink: key.NewBinding(
+			key.WithKeys("l", "l"),
+			key.WithHelp("l", "next link"),
+			key.WithDisabled(),
+		),
+		FollowLink: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "follow link"),
+			key.WithDisabled(),
+		),
+		Back: key.NewBinding(
+			key.WithKeys("b", "b"),
+			key.WithHelp("b", "back"),
+			key.WithDisabled(),
+		),
+		Attachments: key.NewBinding(
+			key.WithKeys("a", "a"),
+			key.WithHelp("a", "attachments"),
+		),
+		Extract: key.NewBinding(
+			key.WithKeys("s", "s"),
+			key.WithHelp("s", "save to current folder"),
+		),
+		Diff: key.NewBinding(
+			key.WithKeys("d", "d"),
+			key.WithHelp("d", "toggle diff"),
+		),
+		Filter: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "show cells"),
+		),
+		Restore: key.NewBinding(
+			key.WithKeys("r", "r"),
+			key.WithHelp("r", "restore"),
+		),
+		Purge: key.NewBinding(
+			key.WithKeys("x", "x"),
+			key.WithHelp("x", "purge"),
+		),
+		KeepOurs: key.NewBinding(
+			key.WithKeys("o", "o"),
+			key.WithHelp("o", "keep mine"),
+		),
+		TakeTheirs: key.NewBinding(
+			key.WithKeys("t", "t"),
+			key.WithHelp("t", "take theirs"),
+		),
+		Undo: key.NewBinding(
+			key.WithKeys("ctrl+z"),
+			key.WithHelp("ctrl+z", "undo delete"),
+			key.WithDisabled(),
+		),
+		CloseHistory: key.NewBinding(
+			key.WithKeys("q", "q"),
+			key.WithHelp("q", "close"),
+		),
 		// Close a single view - stay in app.
 		Quit: key.NewBinding(
 			key.WithKeys("q", "q"),
@@ -75,7 +160,24 @@ type keyMap struct {
 	Save         key.Binding
 	Delete       key.Binding
 	Edit         key.Binding
+	History      key.Binding
+	Metadata     key.Binding
+	NextLink     key.Binding
+	FollowLink   key.Binding
+	Back         key.Binding
+	Attachments  key.Binding
+	Extract      key.Binding
+	Diff         key.Binding
+	Filter       key.Binding
+	Restore      key.Binding
+	Purge        key.Binding
+	KeepOurs     key.Binding
+	TakeTheirs   key.Binding
+	Undo         key.Binding
+	CloseHistory key.Binding
 	ToggleSearch key.Binding
+	DateFilter   key.Binding
+	Order        key.Binding
 	Quit         key.Binding
 	Exit         key.Binding
 }
@@ -85,9 +187,24 @@ func (k keyMap) ShortHelp() []key.Binding {
 	case PageWrite:
 		return []key.Binding{k.Save, k.Exit}
 	case PageView:
-		return []key.Binding{k.Edit, k.Delete, k.Quit, k.Exit}
+		return []key.Binding{
+			k.Edit, k.Delete, k.History, k.Metadata, k.Attachments,
+			k.NextLink, k.FollowLink, k.Back, k.Quit, k.Exit,
+		}
+	case PageMetadata:
+		return []key.Binding{k.Save, k.Exit}
+	case PageAttachments:
+		return []key.Binding{k.Extract, k.CloseHistory, k.Exit}
+	case PageHistory:
+		return []key.Binding{k.Diff, k.Restore, k.CloseHistory, k.Exit}
 	case PageSearch:
-		return []key.Binding{k.ToggleSearch, k.Exit}
+		return []key.Binding{k.ToggleSearch, k.DateFilter, k.Order, k.Undo, k.Exit}
+	case PageTrash:
+		return []key.Binding{k.Restore, k.Purge, k.Quit, k.Exit}
+	case PageTags:
+		return []key.Binding{k.Filter, k.Quit, k.Exit}
+	case PageConflicts:
+		return []key.Binding{k.KeepOurs, k.TakeTheirs, k.Quit, k.Exit}
 	}
 	return nil
 }
@@ -0,0 +1,137 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// How many revisions to show at once in the history pane.
+const historyHeight = 5
+
+// A historyModel lists the revisions of a cell so that the user can
+// browse, diff and restore them.
+type historyModel struct {
+	revisions list.Model
+
+	// Whether to show the selected revision as a diff against the
+	// current revision rather than in full.
+	diff bool
+
+	// The rendered diff of the revision with the id diffFor, which is
+	// kept until another revision is selected.
+	diffFor  string
+	diffView string
+}
+
+func newHistoryModel() *historyModel {
+	revisions := list.New(nil, revisionDelegate{}, 60, historyHeight)
+	revisions.SetShowTitle(false)
+	revisions.SetShowPagination(false)
+	revisions.SetFilteringEnabled(false)
+	revisions.SetShowStatusBar(false)
+	revisions.SetShowHelp(false)
+	revisions.KeyMap.NextPage = key.NewBinding()
+	revisions.KeyMap.PrevPage = key.NewBinding()
+	revisions.DisableQuitKeybindings()
+
+	return &historyModel{revisions: revisions}
+}
+
+func (h *historyModel) Update(msg tea.Msg) (*historyModel, tea.Cmd) {
+	var cmd tea.Cmd
+	h.revisions, cmd = h.revisions.Update(msg)
+	return h, cmd
+}
+
+func (h *historyModel) View() string {
+	return h.revisions.View()
+}
+
+func (h *historyModel) setRevisions(cells historyItems) {
+	items := make([]list.Item, len(cells))
+	for i, c := range cells {
+		items[i] = revision{
+			id:      c.Identifier(),
+			data:    c.Data(),
+			ts:      c.Timestamp(),
+			current: i == 0,
+		}
+	}
+
+	h.revisions.SetItems(items)
+	h.revisions.Select(0)
+	h.diff = false
+	h.diffFor, h.diffView = "", ""
+}
+
+// current returns the newest revision of the cell.
+func (h *historyModel) current() revision {
+	items := h.revisions.Items()
+	if len(items) == 0 {
+		return revision{}
+	}
+	return items[0].(revision)
+}
+
+// selected returns the revision the cursor is on.
+func (h *historyModel) selected() revision {
+	r, _ := h.revisions.SelectedItem().(revision)
+	return r
+}
+
+// renderDiff renders the changes made between the selected revision and
+// the current revision.
+func (h *historyModel) renderDiff() string {
+	if r := h.selected(); r.id != h.diffFor {
+		h.diffFor = r.id
+		h.diffView = renderDiff(diffLines(r.data, h.current().data))
+	}
+	return h.diffView
+}
+
+func (h *historyModel) setWidth(width int) {
+	h.revisions.SetSize(width, historyHeight)
+}
+
+// A revision is the UI element for a row in the history pane.
+type revision struct {
+	id      string
+	data    string
+	ts      time.Time
+	current bool
+}
+
+func (revision) FilterValue() string { return "" }
+
+type revisionDelegate struct{}
+
+func (d revisionDelegate) Height() int                             { return 1 }
+func (d revisionDelegate) Spacing() int                            { return 0 }
+func (d revisionDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d revisionDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	item, ok := listItem.(revision)
+	if !ok {
+		return
+	}
+
+	data := lipgloss.NewStyle().Bold(true).Render(item.ts.Local().Format("02/01/2006 15:04:05"))
+	if item.current {
+		data = data + " • current"
+	}
+
+	var cursor string
+	if index == m.Index() {
+		cursor = cursorStyle.Render("➜ ")
+		data = selectedItemStyle.Render(data)
+	} else {
+		data = "  " + data
+	}
+
+	fmt.Fprintf(w, "%s%s", cursor, data)
+}
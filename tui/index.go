@@ -26,6 +26,16 @@ func newIndexModel() *indexModel {
 			description: "Search and view contents of a cell",
 			page:        PageSearch,
 		},
+		actionItem{
+			title:       "Tags",
+			description: "Browse cells by #tag",
+			page:        PageTags,
+		},
+		actionItem{
+			title:       "Trash",
+			description: "Restore or purge deleted cells",
+			page:        PageTrash,
+		},
 	}
 
 	actions := list.New(listItems, actionDelegate{}, 60, len(listItems)+3)
@@ -43,6 +53,12 @@ func newIndexModel() *indexModel {
 	return &indexModel{actions: actions}
 }
 
+// addAction adds an action to the end of the menu.
+func (s *indexModel) addAction(a actionItem) {
+	s.actions.InsertItem(len(s.actions.Items()), a)
+	s.actions.SetHeight(len(s.actions.Items()) + 3)
+}
+
 func (s *indexModel) Init() tea.Cmd {
 	return nil
 }
@@ -0,0 +1,112 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// How many links to show at once below a cell.
+const linksHeight = 5
+
+var unresolvedLinkStyle = lipgloss.
+	NewStyle().
+	Foreground(lipgloss.Color("241"))
+
+// A link is a [[link]] from the cell being viewed to another, or from
+// another cell to it when back is set.
+type link struct {
+	// The cell the link leads to, which is empty if it doesn't resolve.
+	id    string
+	title string
+	back  bool
+}
+
+// A linksModel lists the links of the cell being viewed and the cells that
+// link to it, so that the user can pick one to follow.
+type linksModel struct {
+	links    []link
+	selected int
+	width    int
+}
+
+func newLinksModel() *linksModel {
+	return &linksModel{selected: -1}
+}
+
+func (l *linksModel) View() string {
+	// Show the window of links that has the selected one in it.
+	start := 0
+	if l.selected >= linksHeight {
+		start = l.selected - linksHeight + 1
+	}
+	end := start + linksHeight
+	if end > len(l.links) {
+		end = len(l.links)
+	}
+
+	lines := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		lnk := l.links[i]
+
+		arrow := "→ "
+		if lnk.back {
+			arrow = "← "
+		}
+		line := arrow + lnk.title
+		if r, w := []rune(line), l.width-4; w > 0 && len(r) > w {
+			line = string(r[:w-1]) + "…"
+		}
+
+		switch {
+		case i == l.selected:
+			line = cursorStyle.Render("➜ ") + selectedItemStyle.Render(line)
+		case lnk.id == "":
+			line = "  " + unresolvedLinkStyle.Render(line)
+		default:
+			line = "  " + line
+		}
+		lines = append(lines, line)
+	}
+	return focusedStyle.Width(l.width).Render(strings.Join(lines, "\n"))
+}
+
+// height returns how many lines the links take up.
+func (l *linksModel) height() int {
+	if len(l.links) < linksHeight {
+		return len(l.links)
+	}
+	return linksHeight
+}
+
+func (l *linksModel) empty() bool {
+	return len(l.links) == 0
+}
+
+func (l *linksModel) setLinks(links []link) {
+	l.links = links
+	l.selected = -1
+}
+
+// next selects the next link that leads somewhere, wrapping around.
+func (l *linksModel) next() {
+	for i := 1; i <= len(l.links); i++ {
+		j := (l.selected + i) % len(l.links)
+		if l.links[j].id != "" {
+			l.selected = j
+			return
+		}
+	}
+}
+
+// target returns the cell the selected link leads to, if any.
+func (l *linksModel) target() string {
+	if l.selected < 0 || l.selected >= len(l.links) {
+		return ""
+	}
+	return l.links[l.selected].id
+}
+
+func (l *linksModel) setWidth(width int) {
+	l.width = width
+}
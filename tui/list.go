@@ -5,11 +5,14 @@ import (
 	"io"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+
+	"github.com/sno6/brain/search"
 )
 
 var (
@@ -31,12 +34,31 @@ var (
 	cursorStyle = lipgloss.
 			NewStyle().
 			Foreground(lipgloss.AdaptiveColor{Light: "#43BF6D", Dark: "#73F59F"})
+
+	matchStyle = lipgloss.
+			NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("#F25D94"))
+)
+
+// How many cells to fetch at once, and how close to the end of the cells
+// fetched so far the cursor gets before the next page is fetched.
+const (
+	listPageSize  = 50
+	listFetchSoon = 10
 )
 
 // A cellListModel is a wrapper around a list.Model that displays cells.
 type cellListModel struct {
 	cells list.Model
 	page  int
+
+	// The search the cells are from, or are about to be, whether it found
+	// more than have been fetched, and whether the next page is on its
+	// way.
+	search   searchMessage
+	more     bool
+	fetching bool
 }
 
 func newCellListModel() *cellListModel {
@@ -51,9 +73,9 @@ func newCellListModel() *cellListModel {
 	cells.SetShowStatusBar(false)
 	cells.SetShowHelp(false)
 
-	// Disable next/prev pagination.
-	cells.KeyMap.NextPage = key.NewBinding()
-	cells.KeyMap.PrevPage = key.NewBinding()
+	// Only page with keys that can't be typed into the search bar.
+	cells.KeyMap.NextPage = key.NewBinding(key.WithKeys("pgdown"))
+	cells.KeyMap.PrevPage = key.NewBinding(key.WithKeys("pgup"))
 	cells.DisableQuitKeybindings()
 
 	return &cellListModel{cells: cells}
@@ -66,25 +88,43 @@ func (c *cellListModel) Init() tea.Cmd {
 func (c *cellListModel) Update(msg tea.Msg) (*cellListModel, tea.Cmd) {
 	cmd := c.updateSubModels(msg)
 
+	// Whether the cursor may have moved or cells have been added, so that
+	// the next page might be needed.
+	var moved bool
+
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		moved = true
 		switch msg.Type {
 		case tea.KeyEnter:
 			c, ok := c.cells.SelectedItem().(cell)
 			if ok {
 				cmd = tea.Batch(
 					cmd,
-					viewCellCommand(c.id, c.data),
+					viewCellCommand(c.id, c.data, c.meta),
 					changePage(PageView),
 				)
 			}
 		}
-	}
 
 	// Search has found some new items, we need to update
 	// our internal model and render the list items.
-	if items, ok := msg.(listItems); ok {
-		c.updateListItems(items)
+	case listItems:
+		moved = true
+		c.updateListItems(msg)
+
+	// The next page couldn't be fetched, it's tried again once the user
+	// moves the cursor.
+	case searchError:
+		if msg.search == c.search {
+			c.fetching = false
+		}
+	}
+
+	// Fetch the next page of cells before the user gets to the end.
+	if moved && c.more && !c.fetching && c.cells.Index() >= len(c.cells.Items())-listFetchSoon {
+		c.fetching = true
+		cmd = tea.Batch(cmd, nextPage(c.search, len(c.cells.Items())))
 	}
 
 	return c, cmd
@@ -96,17 +136,46 @@ func (c *cellListModel) updateSubModels(msg tea.Msg) tea.Cmd {
 	return cmd
 }
 
+// startSearch drops the pages still on their way, so that only the cells
+// of the given search are shown once its first page arrives.
+func (c *cellListModel) startSearch(sm searchMessage) {
+	c.search = sm
+	c.more, c.fetching = false, false
+}
+
+// updateListItems shows the cells of a new search, or adds the next page
+// of cells to those of the current one.
 func (c *cellListModel) updateListItems(items listItems) {
-	cells := make([]list.Item, len(items))
-	for i, item := range items {
-		cells[i] = cell{
-			id:   item.Identifier(),
-			data: item.Data(),
-			ts:   item.Timestamp(),
+	var cells []list.Item
+	switch {
+	case items.search != c.search:
+		// The page is of a search the user has since moved on from.
+		return
+	case items.page.Offset == 0:
+	case items.page.Offset == len(c.cells.Items()):
+		cells = c.cells.Items()
+	default:
+		// The page doesn't follow on from the cells shown, such as one
+		// fetched before the first page of a rerun search arrived.
+		return
+	}
+
+	for _, hit := range items.page.Hits {
+		c := cell{
+			id:   hit.Cell.Identifier(),
+			data: hit.Cell.Data(),
+			ts:   hit.Cell.Timestamp(),
+			meta: hit.Cell.Metadata(),
 		}
+		if len(hit.Fragments) > 0 {
+			c.snippet = &hit.Fragments[0]
+		}
+		cells = append(cells, c)
 	}
 
 	c.cells.SetItems(cells)
+	c.more = items.page.More()
+	c.fetching = false
 }
 
 func (c *cellListModel) setDimensions(width, height int) {
@@ -122,6 +191,10 @@ type cell struct {
 	id   string
 	data string
 	ts   time.Time
+	meta map[string]string
+
+	// Where the search that found the cell matched it, if it says.
+	snippet *search.Fragment
 }
 
 func (c cell) Description() string { return c.data }
@@ -141,12 +214,29 @@ func (d cellDelegate) Render(w io.Writer, m list.Model, index int, listItem list
 	}
 
 	date := itemDateStyle.Render(fmt.Sprintf("%02d/%02d/%02d", item.ts.Day(), item.ts.Month(), item.ts.Year()))
-	data := preview(item.data)
+	selected := index == m.Index()
+
+	var data string
+	switch {
+	case item.snippet != nil:
+		// Show where the search matched rather than how the cell starts.
+		data = renderSnippet(*item.snippet, selected)
+	case item.meta["title"] != "":
+		data = preview(item.meta["title"])
+	default:
+		data = preview(item.data)
+	}
+	if title := item.meta["title"]; title != "" && item.snippet != nil {
+		date += " " + preview(title)
+	}
 
 	var cursor string
-	if index == m.Index() {
+	if selected {
 		cursor = cursorStyle.Render("➜ ")
-		data = "  " + selectedItemStyle.Render(data)
+		if item.snippet == nil {
+			data = selectedItemStyle.Render(data)
+		}
+		data = "  " + data
 	} else {
 		date = "  " + date
 		data = "  " + data
@@ -155,8 +245,12 @@ func (d cellDelegate) Render(w io.Writer, m list.Model, index int, listItem list
 	fmt.Fprintf(w, "%s%s\n%s", cursor, date, data)
 }
 
-// How many characters to show for long cells.
-const previewLength = 70
+// How many characters to show for long cells, and how many to show before
+// the first match in a snippet.
+const (
+	previewLength = 70
+	snippetLead   = 20
+)
 
 func preview(data string) string {
 	if nl := strings.Index(data, "\n"); nl > -1 {
@@ -176,3 +270,54 @@ func preview(data string) string {
 
 	return data[:previewLength] + "..."
 }
+
+// renderSnippet renders a fragment of a cell on a single line, starting
+// shortly before the first match, with the terms that matched highlighted.
+func renderSnippet(f search.Fragment, selected bool) string {
+	text := strings.NewReplacer("\n", " ", "\r", " ", "\t", " ").Replace(f.Text)
+
+	// Skip ahead so that the first match is in view.
+	start := 0
+	if len(f.Matches) > 0 && f.Matches[0][0] > snippetLead {
+		start = f.Matches[0][0] - snippetLead
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+	}
+
+	base := lipgloss.NewStyle()
+	if selected {
+		base = selectedItemStyle
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(base.Render("…"))
+	}
+
+	// Write the text in turns of unmatched and matched parts, until there's
+	// no more room.
+	n, pos := 0, start
+	write := func(s string, style lipgloss.Style) bool {
+		r := []rune(s)
+		if n+len(r) > previewLength {
+			b.WriteString(style.Render(string(r[:previewLength-n])))
+			b.WriteString(base.Render("..."))
+			return false
+		}
+		n += len(r)
+		b.WriteString(style.Render(s))
+		return true
+	}
+	for _, m := range f.Matches {
+		if m[0] < pos {
+			continue
+		}
+		if !write(text[pos:m[0]], base) || !write(text[m[0]:m[1]], matchStyle) {
+			return b.String()
+		}
+		pos = m[1]
+	}
+	write(text[pos:], base)
+	return b.String()
+}
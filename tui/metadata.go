@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// How many lines of metadata to show at once.
+const metadataHeight = 5
+
+var metadataKeyStyle = lipgloss.
+	NewStyle().
+	Bold(true)
+
+// A metadataModel shows the metadata of a cell, such as its title and
+// source, and lets the user edit it as key: value lines.
+type metadataModel struct {
+	text    textarea.Model
+	meta    map[string]string
+	editing bool
+
+	// The error from the last attempt to save the metadata.
+	err error
+}
+
+func newMetadataModel() *metadataModel {
+	text := textarea.New()
+	text.Prompt = ""
+	text.ShowLineNumbers = false
+	text.Cursor.Style = textCursorStyle
+	text.FocusedStyle.CursorLine = focusedCursorLineStyle
+	text.FocusedStyle.Base = focusedStyle
+	text.BlurredStyle.Base = text.FocusedStyle.Base
+	text.CharLimit = -1
+	text.SetHeight(metadataHeight)
+
+	return &metadataModel{text: text}
+}
+
+func (m *metadataModel) Update(msg tea.Msg) (*metadataModel, tea.Cmd) {
+	var cmd tea.Cmd
+	m.text, cmd = m.text.Update(msg)
+	return m, cmd
+}
+
+func (m *metadataModel) View() string {
+	if m.editing {
+		view := m.text.View()
+		if m.err != nil {
+			view = lipgloss.JoinVertical(0, view, errorStyle.Render(m.err.Error()))
+		}
+		return view
+	}
+
+	lines := make([]string, 0, len(m.meta))
+	for _, k := range sortedKeys(m.meta) {
+		lines = append(lines, metadataKeyStyle.Render(k+":")+" "+m.meta[k])
+	}
+	return focusedStyle.Width(m.text.Width()).Render(strings.Join(lines, "\n"))
+}
+
+// empty reports whether there's no metadata to show.
+func (m *metadataModel) empty() bool {
+	return len(m.meta) == 0 && !m.editing
+}
+
+func (m *metadataModel) setMetadata(meta map[string]string) {
+	m.meta = meta
+	m.editing = false
+	m.err = nil
+}
+
+// edit opens the metadata for editing as key: value lines.
+func (m *metadataModel) edit() {
+	lines := make([]string, 0, len(m.meta))
+	for _, k := range sortedKeys(m.meta) {
+		lines = append(lines, k+": "+m.meta[k])
+	}
+	m.text.SetValue(strings.Join(lines, "\n"))
+	m.text.Focus()
+	m.editing = true
+	m.err = nil
+}
+
+func (m *metadataModel) close() {
+	m.text.Blur()
+	m.editing = false
+	m.err = nil
+}
+
+// value returns the metadata as edited, ignoring lines that aren't of the
+// form key: value.
+func (m *metadataModel) value() map[string]string {
+	meta := make(map[string]string)
+	for _, line := range strings.Split(m.text.Value(), "\n") {
+		i := strings.Index(line, ":")
+		if i < 1 {
+			continue
+		}
+		meta[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return meta
+}
+
+func (m *metadataModel) setWidth(width int) {
+	m.text.SetWidth(width)
+}
+
+func sortedKeys(meta map[string]string) []string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
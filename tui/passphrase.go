@@ -0,0 +1,85 @@
+package tui
+
+import (
+	"errors"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ErrCancelled is returned by ReadPassphrase when the user quits instead
+// of entering a passphrase.
+var ErrCancelled = errors.New("cancelled")
+
+var (
+	passphraseTitleStyle = titleStyle.Copy().MarginBottom(1)
+
+	passphraseErrorStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("#FF5F87")).
+				MarginTop(1)
+)
+
+// A passphraseModel asks for the passphrase of an encrypted brain before
+// the rest of the UI starts.
+type passphraseModel struct {
+	title     string
+	message   string
+	input     textinput.Model
+	cancelled bool
+}
+
+// ReadPassphrase prompts for a passphrase under the given title, showing
+// message below the prompt if it isn't empty, e.g. to say that the last
+// passphrase was wrong.
+func ReadPassphrase(title, message string) (string, error) {
+	input := textinput.New()
+	input.Placeholder = "Passphrase"
+	input.EchoMode = textinput.EchoPassword
+	input.EchoCharacter = '•'
+	input.Prompt = "> "
+	input.Focus()
+
+	m := &passphraseModel{title: title, message: message, input: input}
+	if err := tea.NewProgram(m).Start(); err != nil {
+		return "", err
+	}
+	if m.cancelled {
+		return "", ErrCancelled
+	}
+	return m.input.Value(), nil
+}
+
+func (p *passphraseModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (p *passphraseModel) View() string {
+	s := lipgloss.JoinVertical(
+		0,
+		passphraseTitleStyle.Render(p.title),
+		p.input.View(),
+	)
+	if p.message != "" {
+		s = lipgloss.JoinVertical(0, s, passphraseErrorStyle.Render(p.message))
+	}
+	return appStyle.Render(s) + "\n"
+}
+
+func (p *passphraseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			p.cancelled = true
+			return p, tea.Quit
+		case tea.KeyEnter:
+			if p.input.Value() != "" {
+				return p, tea.Quit
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	p.input, cmd = p.input.Update(msg)
+	return p, cmd
+}
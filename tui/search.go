@@ -1,6 +1,10 @@
 package tui
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/sno6/brain/search"
 
 	"github.com/charmbracelet/bubbles/textinput"
@@ -11,6 +15,11 @@ import (
 var (
 	statusStyle = getStatusStyle()
 	barStyle    = getBarStyle()
+
+	searchErrorStyle = lipgloss.
+				NewStyle().
+				Inherit(getBarStyle()).
+				Foreground(lipgloss.Color("#F25D94"))
 )
 
 type searchMode struct {
@@ -20,6 +29,41 @@ type searchMode struct {
 	color       lipgloss.Color
 }
 
+// A dateFilter limits a search to cells created in the last few days, or
+// to any cell if days is 0.
+type dateFilter struct {
+	title string
+	days  int
+}
+
+var dateFilters = []dateFilter{
+	{title: "Any time"},
+	{title: "Past day", days: 1},
+	{title: "Past week", days: 7},
+	{title: "Past month", days: 30},
+	{title: "Past year", days: 365},
+}
+
+// The color of the date filter in the search bar.
+const dateFilterColor = "#3C9BD8"
+
+// A resultOrder is an order the cells found can be listed in.
+type resultOrder struct {
+	title string
+	order search.Order
+}
+
+var resultOrders = []resultOrder{
+	{title: "Best match", order: search.Relevance},
+	{title: "Newest", order: search.Newest},
+	{title: "Oldest", order: search.Oldest},
+	{title: "Recently updated", order: search.RecentlyUpdated},
+	{title: "Recently viewed", order: search.RecentlyViewed},
+}
+
+// The color of the order in the search bar.
+const orderColor = "#5F5F87"
+
 type searchModel struct {
 	input textinput.Model
 	help  *helpModel
@@ -28,6 +72,18 @@ type searchModel struct {
 
 	currModeIdx int
 	modes       []searchMode
+
+	currDateIdx  int
+	currOrderIdx int
+
+	// Why the last search failed, such as a query that can't be parsed.
+	err error
+
+	// How many cells the last search found.
+	total int
+
+	// The last search, see App.startSearch.
+	current searchMessage
 }
 
 func newSearchModel() *searchModel {
@@ -56,6 +112,12 @@ func newSearchModel() *searchModel {
 			color:       "#F25D94",
 			mode:        search.Wildcard,
 		},
+		{
+			title:       "Advanced",
+			placeholder: "Search with +must -not \"phrases\" field:value term~2..",
+			color:       "#E8A33D",
+			mode:        search.Advanced,
+		},
 	}
 
 	input := textinput.New()
@@ -80,7 +142,32 @@ func (s *searchModel) Init() tea.Cmd {
 func (s *searchModel) View() string {
 	mode := s.modes[s.currModeIdx]
 	title := statusStyle.Background(mode.color).Render(mode.title)
+	if s.currDateIdx > 0 {
+		date := dateFilters[s.currDateIdx]
+		title += statusStyle.Background(lipgloss.Color(dateFilterColor)).Render(date.title)
+	}
+	title += statusStyle.Background(lipgloss.Color(orderColor)).Render(resultOrders[s.currOrderIdx].title)
 	input := s.input.View()
+	if s.err != nil {
+		// Show as much of the error as fits after what the user typed.
+		room := s.width - 5 - lipgloss.Width(title+input)
+		if msg := []rune(" ✗ " + s.err.Error()); room > 0 {
+			if len(msg) > room {
+				msg = msg[:room]
+			}
+			input += searchErrorStyle.Render(string(msg))
+		}
+	} else {
+		// Show how many cells were found at the far end of the bar, or
+		// how many there are when the bar is empty and lists them all.
+		count := fmt.Sprintf("%d found", s.total)
+		if s.query() == "" {
+			count = fmt.Sprintf("%d cells", s.total)
+		}
+		if room := s.width - 5 - lipgloss.Width(title+input+count); room > 0 {
+			input += strings.Repeat(" ", room) + count
+		}
+	}
 
 	return lipgloss.JoinVertical(
 		0,
@@ -93,23 +180,77 @@ func (s *searchModel) Update(msg tea.Msg) (*searchModel, tea.Cmd) {
 	cmd := s.updateSubModels(msg)
 
 	switch msg := msg.(type) {
+	case listItems:
+		if msg.search == s.current {
+			s.err = nil
+			s.total = msg.page.Total
+		}
+	case searchError:
+		if msg.search == s.current || msg.search == (searchMessage{}) {
+			s.err = msg.err
+		}
 	case tea.KeyMsg:
 		switch msg.Type {
 		case tea.KeyTab:
 			s.toggleMode()
-			cmd = tea.Batch(searchCommand(s.modes[s.currModeIdx].mode, s.input.Value()))
+			cmd = tea.Batch(s.search())
+		case tea.KeyCtrlT:
+			s.currDateIdx = (s.currDateIdx + 1) % len(dateFilters)
+			cmd = tea.Batch(s.search())
+		case tea.KeyCtrlO:
+			s.currOrderIdx = (s.currOrderIdx + 1) % len(resultOrders)
+			cmd = tea.Batch(s.search())
 		case tea.KeyRunes, tea.KeyBackspace:
-			v := s.input.Value()
-			if v == "" {
-				return s, cmd
-			}
-			cmd = tea.Batch(searchCommand(s.modes[s.currModeIdx].mode, s.input.Value()))
+			// An empty search lists every cell, newest first.
+			cmd = tea.Batch(s.search())
 		}
 	}
 
 	return s, cmd
 }
 
+// startSearch only shows what the given search found from now on, see
+// App.startSearch.
+func (s *searchModel) startSearch(sm searchMessage) {
+	s.current = sm
+}
+
+// setQuery replaces what's in the search bar, returning the search for it.
+func (s *searchModel) setQuery(q string) tea.Cmd {
+	s.input.SetValue(q)
+	s.input.CursorEnd()
+	return s.search()
+}
+
+// search returns the search for what's in the search bar.
+func (s *searchModel) search() tea.Cmd {
+	return searchCommand(s.modes[s.currModeIdx].mode, s.query(), s.order())
+}
+
+// order returns the order the cells found are listed in.
+func (s *searchModel) order() search.Order {
+	return resultOrders[s.currOrderIdx].order
+}
+
+// setOrder lists the cells found in the given order from the next search.
+func (s *searchModel) setOrder(o search.Order) {
+	for i, r := range resultOrders {
+		if r.order == o {
+			s.currOrderIdx = i
+		}
+	}
+}
+
+// query returns what's in the search bar along with the date filter.
+func (s *searchModel) query() string {
+	q := s.input.Value()
+	if days := dateFilters[s.currDateIdx].days; days > 0 {
+		since := time.Now().AddDate(0, 0, -days).Format(time.RFC3339)
+		q = strings.TrimSpace(q + " " + search.CreatedField + ":>=" + since)
+	}
+	return q
+}
+
 func (s *searchModel) toggleMode() {
 	idx := s.currModeIdx
 	if idx == len(s.modes)-1 {
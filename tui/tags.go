@@ -0,0 +1,106 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// A tagsModel lists the tags in use so that the user can pick one to
+// filter their cells by.
+type tagsModel struct {
+	tags list.Model
+	help *helpModel
+}
+
+func newTagsModel() *tagsModel {
+	tags := list.New(nil, tagDelegate{}, 60, 0)
+	tags.Title = "Tags"
+	tags.Styles.Title = titleStyle
+	tags.Styles.TitleBar = lipgloss.NewStyle().MarginBottom(1)
+	tags.Paginator.PerPage = 20
+	tags.Styles.PaginationStyle.PaddingBottom(1)
+	tags.SetShowTitle(true)
+	tags.SetFilteringEnabled(false)
+	tags.SetShowStatusBar(false)
+	tags.SetShowHelp(false)
+	tags.KeyMap.NextPage = key.NewBinding()
+	tags.KeyMap.PrevPage = key.NewBinding()
+	tags.DisableQuitKeybindings()
+
+	return &tagsModel{
+		tags: tags,
+		help: newHelpModel(PageTags),
+	}
+}
+
+func (t *tagsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (t *tagsModel) View() string {
+	return lipgloss.JoinVertical(0, t.tags.View(), t.help.View())
+}
+
+func (t *tagsModel) Update(msg tea.Msg) (*tagsModel, tea.Cmd) {
+	var cmd tea.Cmd
+	t.tags, cmd = t.tags.Update(msg)
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case msg.Type == tea.KeyEnter:
+			if tag, ok := t.tags.SelectedItem().(tagItem); ok {
+				cmd = tea.Batch(cmd, filterByTag(tag.name))
+			}
+		case msg.String() == "q":
+			cmd = tea.Batch(cmd, changePage(PageIndex))
+		}
+	}
+
+	if items, ok := msg.(tagItems); ok {
+		t.tags.SetItems(items)
+	}
+
+	return t, cmd
+}
+
+func (t *tagsModel) setDimensions(width, height int) {
+	t.tags.SetSize(width, height-4)
+}
+
+// A tagItem is the UI element for a row in the tags list.
+type tagItem struct {
+	name  string
+	count int
+}
+
+func (tagItem) FilterValue() string { return "" }
+
+type tagDelegate struct{}
+
+func (d tagDelegate) Height() int                             { return 1 }
+func (d tagDelegate) Spacing() int                            { return 0 }
+func (d tagDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d tagDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	item, ok := listItem.(tagItem)
+	if !ok {
+		return
+	}
+
+	data := lipgloss.NewStyle().Bold(true).Render("#"+item.name) + fmt.Sprintf(" • %d", item.count)
+
+	var cursor string
+	if index == m.Index() {
+		cursor = cursorStyle.Render("➜ ")
+		data = selectedItemStyle.Render(data)
+	} else {
+		data = "  " + data
+	}
+
+	fmt.Fprintf(w, "%s%s", cursor, data)
+}
@@ -0,0 +1,97 @@
+package tui
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// A trashModel lists the cells in the trash so that the user can restore
+// or purge them.
+type trashModel struct {
+	cells list.Model
+	help  *helpModel
+
+	// Why the last cell the user restored or purged couldn't be.
+	err error
+}
+
+func newTrashModel() *trashModel {
+	cells := list.New(nil, cellDelegate{}, 60, 0)
+	cells.Title = "Trash"
+	cells.Styles.Title = titleStyle
+	cells.Styles.TitleBar = lipgloss.NewStyle().MarginBottom(1)
+	cells.Paginator.PerPage = 10
+	cells.Styles.PaginationStyle.PaddingBottom(1)
+	cells.SetShowTitle(true)
+	cells.SetFilteringEnabled(false)
+	cells.SetShowStatusBar(false)
+	cells.SetShowHelp(false)
+	cells.KeyMap.NextPage = key.NewBinding()
+	cells.KeyMap.PrevPage = key.NewBinding()
+	cells.DisableQuitKeybindings()
+
+	return &trashModel{
+		cells: cells,
+		help:  newHelpModel(PageTrash),
+	}
+}
+
+func (t *trashModel) Init() tea.Cmd {
+	return nil
+}
+
+func (t *trashModel) View() string {
+	views := []string{t.cells.View()}
+	if t.err != nil {
+		views = append(views, errorStyle.Render(t.err.Error()))
+	}
+	return lipgloss.JoinVertical(0, append(views, t.help.View())...)
+}
+
+func (t *trashModel) Update(msg tea.Msg) (*trashModel, tea.Cmd) {
+	var cmd tea.Cmd
+	t.cells, cmd = t.cells.Update(msg)
+
+	switch msg := msg.(type) {
+	case trashError:
+		t.err = msg.err
+	case tea.KeyMsg:
+		if msg.Type != tea.KeyRunes {
+			break
+		}
+
+		t.err = nil
+		switch msg.String() {
+		case "r":
+			if c, ok := t.cells.SelectedItem().(cell); ok {
+				cmd = tea.Batch(cmd, restoreCell(c.id))
+			}
+		case "x":
+			if c, ok := t.cells.SelectedItem().(cell); ok {
+				cmd = tea.Batch(cmd, purgeCell(c.id))
+			}
+		case "q":
+			cmd = tea.Batch(cmd, changePage(PageIndex))
+		}
+	}
+
+	if items, ok := msg.(trashItems); ok {
+		cells := make([]list.Item, len(items))
+		for i, item := range items {
+			cells[i] = cell{
+				id:   item.Identifier(),
+				data: item.Data(),
+				ts:   item.TrashedAt(),
+			}
+		}
+		t.cells.SetItems(cells)
+	}
+
+	return t, cmd
+}
+
+func (t *trashModel) setDimensions(width, height int) {
+	t.cells.SetSize(width, height-4)
+}